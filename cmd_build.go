@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+
+	"github.com/mattn/jedie/site"
 	"github.com/urfave/cli"
 )
 
@@ -10,16 +13,15 @@ func init() {
 		Aliases: []string{"b"},
 		Usage:   "Build your site",
 		Action: func(c *cli.Context) error {
-			if err := cfg.load("_config.yml"); err != nil {
+			s := site.New(site.Options{
+				Source:         c.String("s"),
+				Destination:    c.String("d"),
+				WarnCollisions: c.Bool("warn-collisions"),
+			})
+			if err := s.Load(); err != nil {
 				return err
 			}
-			if c.String("s") != "" {
-				cfg.Source = c.String("s")
-			}
-			if c.String("d") != "" {
-				cfg.Destination = c.String("d")
-			}
-			return cfg.Build()
+			return s.Build(context.Background())
 		},
 		Flags: []cli.Flag{
 			cli.StringFlag{
@@ -30,6 +32,10 @@ func init() {
 				Name:  "d",
 				Usage: "destination path",
 			},
+			cli.BoolFlag{
+				Name:  "warn-collisions",
+				Usage: "warn instead of failing when files are written to the same path",
+			},
 		},
 	})
 }
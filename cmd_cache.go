@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mattn/jedie/site"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	load := func() (*site.Site, error) {
+		s := site.New(site.Options{})
+		if err := s.Load(); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	app.Commands = append(app.Commands, cli.Command{
+		Name:  "cache",
+		Usage: "Manage the cache of the conversion outputs",
+		Subcommands: []cli.Command{
+			{
+				Name:  "stats",
+				Usage: "Show the size of the cache",
+				Action: func(c *cli.Context) error {
+					s, err := load()
+					if err != nil {
+						return err
+					}
+					stats, err := s.CacheStats()
+					if err != nil {
+						return err
+					}
+					fmt.Printf("%s: %d entries, %d bytes\n", stats.Dir, stats.Entries, stats.Size)
+					return nil
+				},
+			},
+			{
+				Name:  "clear",
+				Usage: "Remove the entries of the cache",
+				Action: func(c *cli.Context) error {
+					s, err := load()
+					if err != nil {
+						return err
+					}
+					return s.ClearCache()
+				},
+			},
+		},
+	})
+}
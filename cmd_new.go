@@ -1,6 +1,7 @@
 package main
 
 import (
+	"github.com/mattn/jedie/site"
 	"github.com/urfave/cli"
 )
 
@@ -14,7 +15,16 @@ func init() {
 				cli.ShowCommandHelp(c, "new")
 				return nil
 			}
-			return cfg.New(c.Args().First())
+			if c.String("theme") != "" {
+				return site.CreateWithTheme(c.Args().First(), c.String("theme"))
+			}
+			return site.Create(c.Args().First())
+		},
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "theme",
+				Usage: "theme directory of the site",
+			},
 		},
 	})
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"github.com/mattn/jedie/site"
 	"github.com/urfave/cli"
 )
 
@@ -14,10 +15,11 @@ func init() {
 				cli.ShowCommandHelp(c, "newpost")
 				return nil
 			}
-			if err := cfg.load("_config.yml"); err != nil {
+			s := site.New(site.Options{})
+			if err := s.Load(); err != nil {
 				return err
 			}
-			return cfg.NewPost(c.Args().First())
+			return s.NewPost(c.Args().First())
 		},
 	})
 }
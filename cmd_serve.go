@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+
+	"github.com/mattn/jedie/site"
 	"github.com/urfave/cli"
 )
 
@@ -10,10 +13,21 @@ func init() {
 		Aliases: []string{"s"},
 		Usage:   "Serve your site locally",
 		Action: func(c *cli.Context) error {
-			if err := cfg.load("_config.yml"); err != nil {
+			var opts site.Options
+			if c.Bool("memory") {
+				opts.Output = site.NewMemoryOutput()
+			}
+			s := site.New(opts)
+			if err := s.Load(); err != nil {
 				return err
 			}
-			return cfg.Serve()
+			return s.Serve(context.Background())
+		},
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "memory",
+				Usage: "build the site in memory and serve it without writing the destination",
+			},
 		},
 	})
 }
@@ -1,13 +1,43 @@
 module github.com/mattn/jedie
 
-go 1.14
+go 1.23
 
 require (
+	github.com/andybalholm/brotli v1.1.1
 	github.com/flosch/pongo2 v0.0.0-20190707114632-bbf5a6c351f4
 	github.com/howeyc/fsnotify v0.9.0
+	github.com/klauspost/compress v1.17.11
 	github.com/lestrrat/go-strftime v0.0.0-20180220042222-ba3bf9c1d042
-	github.com/pkg/errors v0.9.1 // indirect
+	github.com/osteele/liquid v1.6.0
 	github.com/russross/blackfriday/v2 v2.0.1
+	github.com/tdewolff/minify/v2 v2.23.0
 	github.com/urfave/cli v1.22.4
+	golang.org/x/image v0.24.0
 	gopkg.in/yaml.v1 v1.0.0-20140924161607-9f9df34309c0
 )
+
+require (
+	github.com/BurntSushi/toml v0.3.1 // indirect
+	github.com/cpuguy83/go-md2man/v2 v2.0.0-20190314233015-f79a8a8ca69d // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/go-check/check v0.0.0-20180628173108-788fd7840127 // indirect
+	github.com/juju/errors v0.0.0-20181118221551-089d3ea4e4d5 // indirect
+	github.com/juju/loggo v0.0.0-20180524022052-584905176618 // indirect
+	github.com/juju/testing v0.0.0-20180920084828-472a3e8b2073 // indirect
+	github.com/kr/pretty v0.1.0 // indirect
+	github.com/kr/pty v1.1.1 // indirect
+	github.com/kr/text v0.1.0 // indirect
+	github.com/mattn/goveralls v0.0.2 // indirect
+	github.com/osteele/tuesday v1.0.3 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/shurcooL/sanitized_anchor_name v1.0.0 // indirect
+	github.com/stretchr/objx v0.1.0 // indirect
+	github.com/stretchr/testify v1.7.0 // indirect
+	github.com/tdewolff/parse/v2 v2.7.22 // indirect
+	golang.org/x/tools v0.0.0-20181221001348-537d06c36207 // indirect
+	gopkg.in/check.v1 v0.0.0-20161208181325-20d25e280405 // indirect
+	gopkg.in/mgo.v2 v2.0.0-20180705113604-9856a29383ce // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
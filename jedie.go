@@ -1,19 +1,19 @@
 package main
 
 import (
+	"log"
 	"os"
 
 	"github.com/urfave/cli"
 )
 
-var (
-	app = cli.NewApp()
-	cfg config
-)
+var app = cli.NewApp()
 
 func main() {
 	app.Name = "jedie"
 	app.Usage = "Static site generator written in golang"
 	app.Version = "0.0.1"
-	app.Run(os.Args)
+	if err := app.Run(os.Args); err != nil {
+		log.Fatal(err)
+	}
 }
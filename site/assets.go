@@ -0,0 +1,403 @@
+package site
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/flosch/pongo2"
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/minify/v2/css"
+	"github.com/tdewolff/minify/v2/html"
+	"github.com/tdewolff/minify/v2/js"
+	jsonmin "github.com/tdewolff/minify/v2/json"
+	"github.com/tdewolff/minify/v2/svg"
+	"github.com/tdewolff/minify/v2/xml"
+)
+
+// assets are the bundles of CSS and JavaScript built from the files of the
+// source directory, without external tools:
+//
+//	assets:
+//	  minify: true
+//	  bundles:
+//	    main.css: [css/reset.css, css/site.css]
+//	    app.js: [js/menu.js, js/search.js]
+//
+// The bundles are written in Dir of the destination. With Minify, the bundles
+// and the HTML, SVG, JSON and XML outputs are minified.
+//
+// With Fingerprint, the bundles and the static files of FingerprintExts
+// (css and js by default) are written with the hash of their content in the
+// name, such as css/site.3f9a1c2b.css, and the Manifest maps their paths to
+// the URLs. With SRI, the manifest and asset_tag have the integrity of the
+// files.
+type assets struct {
+	Dir             string              `yaml:"dir"`
+	Minify          bool                `yaml:"minify"`
+	Bundles         map[string][]string `yaml:"bundles"`
+	Fingerprint     bool                `yaml:"fingerprint"`
+	FingerprintExts []string            `yaml:"fingerprint_exts"`
+	Manifest        string              `yaml:"manifest"`
+	SRI             bool                `yaml:"sri"`
+}
+
+// bundle is an asset bundle built by read.
+type bundle struct {
+	name string
+	to   string
+	url  string
+	data []byte
+}
+
+// asset is a bundle or a fingerprinted file, by the path asset_url takes.
+type asset struct {
+	url       string
+	integrity string
+}
+
+// mediaTypes are the media types of the files minified.
+var mediaTypes = map[string]string{
+	".css":  "text/css",
+	".js":   "application/javascript",
+	".html": "text/html",
+	".svg":  "image/svg+xml",
+	".json": "application/json",
+	".xml":  "text/xml",
+}
+
+var minifier = func() *minify.M {
+	m := minify.New()
+	m.AddFunc("text/css", css.Minify)
+	m.AddFunc("text/html", html.Minify)
+	m.AddFunc("image/svg+xml", svg.Minify)
+	m.AddFuncRegexp(regexp.MustCompile("^(application|text)/(x-)?(java|ecma)script$"), js.Minify)
+	m.AddFuncRegexp(regexp.MustCompile("[/+]json$"), jsonmin.Minify)
+	m.AddFuncRegexp(regexp.MustCompile("[/+]xml$"), xml.Minify)
+	return m
+}()
+
+// minifyFile minifies data of the file name by its extension. Files of other
+// types are returned as is.
+func minifyFile(name string, data []byte) ([]byte, error) {
+	mediatype, ok := mediaTypes[strings.ToLower(filepath.Ext(name))]
+	if !ok {
+		return data, nil
+	}
+	return minifier.Bytes(mediatype, data)
+}
+
+// checkAssets checks the bundles of the config.
+func (cfg *config) checkAssets() error {
+	if cfg.Assets.Dir == "" {
+		cfg.Assets.Dir = "assets"
+	}
+	if _, err := generatorPath(cfg.Destination, cfg.Assets.Dir); err != nil {
+		return fmt.Errorf("assets: dir: %v", err)
+	}
+	if cfg.Assets.Manifest == "" {
+		cfg.Assets.Manifest = path.Join(cfg.Assets.Dir, "manifest.json")
+	}
+	if _, err := generatorPath(cfg.Destination, cfg.Assets.Manifest); err != nil {
+		return fmt.Errorf("assets: manifest: %v", err)
+	}
+	if len(cfg.Assets.FingerprintExts) == 0 {
+		cfg.Assets.FingerprintExts = []string{"css", "js"}
+	}
+	for name, inputs := range cfg.Assets.Bundles {
+		switch filepath.Ext(name) {
+		case ".css", ".js":
+		default:
+			return fmt.Errorf("assets: %s: bundles must be .css or .js", name)
+		}
+		if _, err := generatorPath(cfg.Destination, name); err != nil {
+			return fmt.Errorf("assets: %s: %v", name, err)
+		}
+		if len(inputs) == 0 {
+			return fmt.Errorf("assets: %s: no inputs", name)
+		}
+	}
+	return nil
+}
+
+// bundleInputs returns the paths of the inputs of the bundles, which are not
+// copied to the destination as is.
+func (cfg *config) bundleInputs() map[string]bool {
+	inputs := map[string]bool{}
+	for _, files := range cfg.Assets.Bundles {
+		for _, f := range files {
+			inputs[cfg.lookupSource(f)] = true
+		}
+	}
+	return inputs
+}
+
+// buildBundles concatenates the inputs of the bundles, and minifies them.
+func (cfg *config) buildBundles() error {
+	names := make([]string, 0, len(cfg.Assets.Bundles))
+	for name := range cfg.Assets.Bundles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cfg.bundles = map[string]*bundle{}
+	for _, name := range names {
+		var buf bytes.Buffer
+		for i, f := range cfg.Assets.Bundles[name] {
+			b, err := cfg.readFile(cfg.lookupSource(f))
+			if err != nil {
+				return fmt.Errorf("assets: %s: %v", name, err)
+			}
+			if i > 0 {
+				// A statement of a script may be left open.
+				if filepath.Ext(name) == ".js" {
+					buf.WriteString(";")
+				}
+				buf.WriteString("\n")
+			}
+			buf.Write(b)
+		}
+		data := buf.Bytes()
+		if cfg.Assets.Minify {
+			b, err := minifyFile(name, data)
+			if err != nil {
+				return fmt.Errorf("assets: %s: %v", name, err)
+			}
+			data = b
+		}
+		p := path.Join(cfg.Assets.Dir, name)
+		if cfg.Assets.Fingerprint {
+			p = fingerprintName(p, data)
+		}
+		cfg.bundles[name] = &bundle{
+			name: name,
+			to:   cfg.Destination + "/" + p,
+			url:  urlJoin(cfg.Baseurl, "/"+p),
+			data: data,
+		}
+	}
+	return nil
+}
+
+func (cfg *config) bundleNames() []string {
+	names := make([]string, 0, len(cfg.bundles))
+	for name := range cfg.bundles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fingerprintName returns the path p with the hash of data before the
+// extension.
+func fingerprintName(p string, data []byte) string {
+	sum := sha256.Sum256(data)
+	ext := path.Ext(p)
+	return p[:len(p)-len(ext)] + "." + hex.EncodeToString(sum[:4]) + ext
+}
+
+// integrity returns the Subresource Integrity of data.
+func integrity(data []byte) string {
+	sum := sha512.Sum384(data)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// isFingerprinted returns true if the static file is fingerprinted.
+func (cfg *config) isFingerprinted(from string) bool {
+	if !cfg.Assets.Fingerprint || cfg.isConvertable(from) {
+		return false
+	}
+	ext := strings.TrimPrefix(path.Ext(from), ".")
+	for _, e := range cfg.Assets.FingerprintExts {
+		if strings.TrimPrefix(e, ".") == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// indexAssets records the bundles, and fingerprints the static files of the
+// pages: their URLs and the paths written get the hash of the content written.
+func (cfg *config) indexAssets(pages []pongo2.Context) error {
+	cfg.assets = map[string]*asset{}
+	cfg.fingerprinted = map[string]string{}
+	for name, b := range cfg.bundles {
+		cfg.assets[name] = &asset{url: b.url, integrity: integrity(b.data)}
+	}
+	for _, page := range pages {
+		from := page["path"].(string)
+		if !cfg.isFingerprinted(from) {
+			continue
+		}
+		data, err := cfg.staticContent(from)
+		if err != nil {
+			return err
+		}
+		to := fingerprintName(cfg.toPage(from, page), data)
+		page["url"] = urlJoin(cfg.Baseurl, to[len(cfg.Destination):])
+		cfg.fingerprinted[from] = to
+		if rel := cfg.sourceRel(from); rel != "" {
+			cfg.assets[rel] = &asset{url: str(page["url"]), integrity: integrity(data)}
+		}
+	}
+	return nil
+}
+
+// staticContent returns the content of the static file as it is written.
+func (cfg *config) staticContent(from string) ([]byte, error) {
+	if page, ok := cfg.virtual[from]; ok {
+		return cfg.minifyOutput(from, []byte(page.content)), nil
+	}
+	b, err := cfg.readFile(from)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.minifyOutput(from, b), nil
+}
+
+// pageDest returns the path of the page in the destination.
+func (cfg *config) pageDest(from string, page pongo2.Context) string {
+	if to, ok := cfg.fingerprinted[from]; ok {
+		return to
+	}
+	return cfg.toPage(from, page)
+}
+
+// manifest returns the manifest of the bundles and fingerprinted files, or
+// nil if nothing is fingerprinted.
+func (cfg *config) manifest() ([]byte, error) {
+	if !cfg.Assets.Fingerprint {
+		return nil, nil
+	}
+	type entry struct {
+		URL       string `json:"url"`
+		Integrity string `json:"integrity,omitempty"`
+	}
+	m := map[string]entry{}
+	for name, a := range cfg.assets {
+		e := entry{URL: a.url}
+		if cfg.Assets.SRI {
+			e.Integrity = a.integrity
+		}
+		m[name] = e
+	}
+	return json.MarshalIndent(m, "", "  ")
+}
+
+func (cfg *config) manifestDest() string {
+	return cfg.Destination + "/" + path.Clean(cfg.Assets.Manifest)
+}
+
+// lookupAsset returns the bundle named name, the fingerprinted file or the
+// other static file at the path relative to the source directory.
+func (cfg *config) lookupAsset(name string) (*asset, error) {
+	name = path.Clean(strings.TrimPrefix(strings.TrimSpace(name), "/"))
+	if a, ok := cfg.assets[name]; ok {
+		return a, nil
+	}
+	if u, ok := cfg.links[name]; ok {
+		from := cfg.lookupSource(name)
+		if cfg.isConvertable(from) {
+			return &asset{url: u}, nil
+		}
+		data, err := cfg.staticContent(from)
+		if err != nil {
+			return nil, err
+		}
+		return &asset{url: u, integrity: integrity(data)}, nil
+	}
+	return nil, fmt.Errorf("no bundle or file named %q", name)
+}
+
+// assetURL returns the URL of the bundle named name, or of the file at the
+// path relative to the source directory.
+func (cfg *config) assetURL(name string) (string, error) {
+	a, err := cfg.lookupAsset(name)
+	if err != nil {
+		return "", fmt.Errorf("asset_url: %v", err)
+	}
+	return a.url, nil
+}
+
+// assetIntegrity returns the Subresource Integrity of the asset.
+func (cfg *config) assetIntegrity(name string) (string, error) {
+	a, err := cfg.lookupAsset(name)
+	if err == nil && a.integrity == "" {
+		err = fmt.Errorf("%s is rendered", name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("asset_integrity: %v", err)
+	}
+	return a.integrity, nil
+}
+
+// assetTag returns the link element of the stylesheet or the script element
+// of the asset, with the integrity if sri is set.
+func (cfg *config) assetTag(name string) (string, error) {
+	a, err := cfg.lookupAsset(name)
+	if err != nil {
+		return "", fmt.Errorf("asset_tag: %v", err)
+	}
+	attrs := ""
+	if cfg.Assets.SRI && a.integrity != "" {
+		attrs = fmt.Sprintf(` integrity="%s" crossorigin="anonymous"`, a.integrity)
+	}
+	switch path.Ext(strings.TrimSpace(name)) {
+	case ".css":
+		return fmt.Sprintf(`<link rel="stylesheet" href="%s"%s>`, htmlEscape(a.url), attrs), nil
+	case ".js":
+		return fmt.Sprintf(`<script src="%s"%s></script>`, htmlEscape(a.url), attrs), nil
+	}
+	return "", fmt.Errorf("asset_tag: %s: not a stylesheet or a script", name)
+}
+
+func registerAssetFilters(cfg *config) {
+	setFilter("asset_url", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		u, err := cfg.assetURL(in.String())
+		if err != nil {
+			return nil, filterError("asset_url", err)
+		}
+		return pongo2.AsValue(u), nil
+	})
+	setFilter("asset_integrity", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		s, err := cfg.assetIntegrity(in.String())
+		if err != nil {
+			return nil, filterError("asset_integrity", err)
+		}
+		return pongo2.AsValue(s), nil
+	})
+	setFilter("asset_tag", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		s, err := cfg.assetTag(in.String())
+		if err != nil {
+			return nil, filterError("asset_tag", err)
+		}
+		return pongo2.AsSafeValue(s), nil
+	})
+}
+
+// minifyOutput minifies the HTML, SVG, JSON and XML outputs if minify is
+// set.
+func (cfg *config) minifyOutput(to string, data []byte) []byte {
+	if !cfg.Assets.Minify {
+		return data
+	}
+	switch filepath.Ext(to) {
+	case ".html", ".svg", ".json", ".xml":
+		b, err := minifyFile(to, data)
+		if err != nil {
+			cfg.warnf("%s: minify: %v", to, err)
+			return data
+		}
+		return b
+	}
+	return data
+}
@@ -0,0 +1,137 @@
+package site
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAssets(t *testing.T) {
+	files := fstest.MapFS{
+		"_posts":        {Mode: fs.ModeDir},
+		"css/reset.css": {Data: []byte("body {\n  margin: 0px;\n}\n")},
+		"css/site.css":  {Data: []byte("/* site */\na { color: #ff0000; }\n")},
+		"js/a.js":       {Data: []byte("var a = 1\n")},
+		"js/b.js":       {Data: []byte("(function () {\n  console.log(a)\n})()\n")},
+		"logo.svg":      {Data: []byte("<svg  xmlns=\"http://www.w3.org/2000/svg\">\n  <rect width=\"10\" />\n</svg>\n")},
+	}
+	tests := []struct {
+		engine string
+		page   string
+	}{
+		{"pongo2", `<link href="{% asset_url main.css %}"> <script src="{{ "app.js"|asset_url }}"></script> <img src="{% asset_url logo.svg %}">`},
+		{"liquid", `<link href="{% asset_url main.css %}"> <script src="{{ "app.js" | asset_url }}"></script> <img src="{% asset_url logo.svg %}">`},
+	}
+	for _, test := range tests {
+		fsys := fstest.MapFS{
+			"_config.yml": {Data: []byte("template_engine: " + test.engine + "\nassets:\n  minify: true\n  bundles:\n    main.css: [css/reset.css, css/site.css]\n    app.js: [js/a.js, js/b.js]")},
+			"index.html":  {Data: []byte("---\n---\n" + test.page + "\n")},
+		}
+		for name, f := range files {
+			fsys[name] = f
+		}
+		out := NewMemoryOutput()
+		s := New(Options{FS: fsys, Output: out, Stdout: ioutil.Discard})
+		if err := s.Load(); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Build(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		for name, want := range map[string]string{
+			"assets/main.css": "body{margin:0}a{color:red}",
+			"assets/app.js":   "var a=1;(function(){console.log(a)})()",
+			"index.html":      `<link href=/assets/main.css><script src=/assets/app.js></script><img src=/logo.svg>`,
+			"logo.svg":        `<svg xmlns="http://www.w3.org/2000/svg"><rect width="10"/></svg>`,
+		} {
+			b, ok := out.ReadFile(name)
+			if !ok {
+				t.Fatalf("%s: %s: not written, got %v", test.engine, name, out.Names())
+			}
+			if got := strings.TrimSpace(string(b)); got != want {
+				t.Errorf("%s: %s: want %q but got %q", test.engine, name, want, got)
+			}
+		}
+		for _, name := range []string{"css/site.css", "js/a.js"} {
+			if _, ok := out.ReadFile(name); ok {
+				t.Errorf("%s: want the input %s bundled but it is copied", test.engine, name)
+			}
+		}
+	}
+
+	for _, config := range []string{
+		"assets:\n  bundles:\n    main.scss: [a.scss]",
+		"assets:\n  bundles:\n    main.css: []",
+		"assets:\n  bundles:\n    ../main.css: [a.css]",
+	} {
+		s := New(Options{FS: fstest.MapFS{"_config.yml": {Data: []byte(config)}}, Output: NewMemoryOutput()})
+		if err := s.Load(); err == nil || !strings.HasPrefix(err.Error(), "assets: ") {
+			t.Errorf("%q: want an assets error but got %v", config, err)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	css := "a{color:red}"
+	script := "var a=1"
+	fsys := fstest.MapFS{
+		"_config.yml":  {Data: []byte("assets:\n  fingerprint: true\n  sri: true\n  bundles:\n    app.js: [js/a.js]")},
+		"_posts":       {Mode: fs.ModeDir},
+		"css/site.css": {Data: []byte(css)},
+		"js/a.js":      {Data: []byte(script)},
+		"robots.txt":   {Data: []byte("ok")},
+		"index.html":   {Data: []byte("---\n---\n{{ \"css/site.css\"|asset_url }} {% asset_tag app.js %} {% asset_integrity css/site.css %}")},
+	}
+	out := NewMemoryOutput()
+	s := New(Options{FS: fsys, Output: out, Stdout: ioutil.Discard})
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Build(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	cssName := fingerprintName("css/site.css", []byte(css))
+	jsName := fingerprintName("assets/app.js", []byte(script))
+	if !regexp.MustCompile(`^css/site\.[0-9a-f]{8}\.css$`).MatchString(cssName) {
+		t.Fatalf("want a hash in the name but got %q", cssName)
+	}
+	for _, name := range []string{cssName, jsName, "robots.txt"} {
+		if _, ok := out.ReadFile(name); !ok {
+			t.Fatalf("want %s written but got %v", name, out.Names())
+		}
+	}
+	if _, ok := out.ReadFile("css/site.css"); ok {
+		t.Fatal("want css/site.css written only with the hash")
+	}
+
+	b, _ := out.ReadFile("index.html")
+	want := "/" + cssName + ` <script src="/` + jsName + `" integrity="` + integrity([]byte(script)) + `" crossorigin="anonymous"></script> ` + integrity([]byte(css))
+	if got := strings.TrimSpace(string(b)); got != want {
+		t.Fatalf("want %q but got %q", want, got)
+	}
+
+	b, ok := out.ReadFile("assets/manifest.json")
+	if !ok {
+		t.Fatalf("want the manifest but got %v", out.Names())
+	}
+	var manifest map[string]map[string]string
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if got := manifest["css/site.css"]; got["url"] != "/"+cssName || got["integrity"] != integrity([]byte(css)) {
+		t.Fatalf("want css/site.css in the manifest but got %v", manifest)
+	}
+	if got := manifest["app.js"]; got["url"] != "/"+jsName {
+		t.Fatalf("want app.js in the manifest but got %v", manifest)
+	}
+	if _, ok := manifest["robots.txt"]; ok {
+		t.Fatalf("want only css and js fingerprinted but got %v", manifest)
+	}
+}
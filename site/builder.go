@@ -0,0 +1,1210 @@
+package site
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flosch/pongo2"
+	"github.com/howeyc/fsnotify"
+	"gopkg.in/yaml.v1"
+)
+
+// buildMu serializes builds, since the filters and tags of pongo2 are
+// registered globally for the site being built.
+var buildMu sync.Mutex
+
+type config struct {
+	Baseurl        string                 `yaml:"baseurl"`
+	Title          string                 `yaml:"title"`
+	Source         string                 `yaml:"source"`
+	Name           string                 `yaml:"name"`
+	Destination    string                 `yaml:"destination"`
+	Posts          string                 `yaml:"posts"`
+	Data           string                 `yaml:"data"`
+	Includes       string                 `yaml:"includes"`
+	Layouts        string                 `yaml:"layouts"`
+	Shortcodes     string                 `yaml:"shortcodes"`
+	Permalink      string                 `yaml:"permalink"`
+	Exclude        []string               `yaml:"exclude"`
+	Host           string                 `yaml:"host"`
+	Port           int                    `yaml:"port"`
+	LimitPosts     int                    `yaml:"limit_posts"`
+	MarkdownExt    string                 `yaml:"markdown_ext"`
+	Paginate       int                    `yaml:"paginate"`
+	Timezone       string                 `yaml:"timezone"`
+	TemplateEngine string                 `yaml:"template_engine"`
+	Collections    map[string]collection  `yaml:"collections"`
+	Conversion     map[string]*conversion `yaml:"conversion"`
+	Autoescape     bool                   `yaml:"autoescape"`
+	LegacyFilters  bool                   `yaml:"legacy_filters"`
+	WarnCollisions bool                   `yaml:"warn_collisions"`
+	CacheDir       string                 `yaml:"cache_dir"`
+	NoCache        bool                   `yaml:"no_cache"`
+	Assets         assets                 `yaml:"assets"`
+	Images         images                 `yaml:"images"`
+	Sass           sass                   `yaml:"sass"`
+	Compress       compress               `yaml:"compress"`
+	Search         search                 `yaml:"search"`
+	Related        related                `yaml:"related"`
+	Theme          string                 `yaml:"theme"`
+	Generators     []generator            `yaml:"generators"`
+	Hooks          map[string][][]string  `yaml:"hooks"`
+	HookTimeout    string                 `yaml:"hook_timeout"`
+	vars           pongo2.Context
+	tplset         *pongo2.TemplateSet
+	tplengine      templateEngine
+	loc            *time.Location
+	themeDir       string
+	themeLayouts   string
+	themeIncludes  string
+	settings       map[interface{}]interface{}
+	virtual        map[string]virtualPage
+	generated      []generatedFile
+	posts          []pongo2.Context
+	pages          []pongo2.Context
+	stdout         io.Writer
+	warned         map[string]bool
+	links          map[string]string
+	postLinks      map[string]string
+	fsys           fs.FS
+	fsRoot         string
+	base           string
+	onDisk         bool
+	output         Output
+	site           *Site
+	bundles        map[string]*bundle
+	assets         map[string]*asset
+	fingerprinted  map[string]string
+	images         map[string]*imageSet
+	rendered       map[string]string
+	related        map[string][]pongo2.Context
+	outputs        map[string]outputOwner
+	extends        map[string]error
+	safeHTML       map[string]bool
+	renderVars     []pongo2.Context
+}
+
+// Posts holds the information about context of post.
+type Posts []pongo2.Context
+
+func (p Posts) Len() int {
+	return len(p)
+}
+
+func (p Posts) Less(i, j int) bool {
+	return p[i]["date"].(time.Time).UnixNano() < p[j]["date"].(time.Time).UnixNano()
+}
+
+func (p Posts) Swap(i, j int) {
+	p[i], p[j] = p[j], p[i]
+}
+
+func (cfg *config) load(file string) error {
+	b, err := cfg.readFile(cfg.abs(file))
+	if err != nil {
+		return err
+	}
+
+	err = yaml.Unmarshal(b, cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.Theme != "" {
+		if b, err = cfg.loadTheme(b); err != nil {
+			return err
+		}
+		if err := yaml.Unmarshal(b, cfg); err != nil {
+			return err
+		}
+	}
+	cfg.settings = nil
+	if err := yaml.Unmarshal(b, &cfg.settings); err != nil {
+		return err
+	}
+	cfg.vars = pongo2.Context{}
+
+	if cfg.Source == "" {
+		cfg.Source = "."
+	}
+	if cfg.Destination == "" {
+		cfg.Destination = "_site"
+	}
+	if cfg.Posts == "" {
+		cfg.Posts = "_posts"
+	}
+	if cfg.Data == "" {
+		cfg.Data = "_data"
+	}
+	if cfg.Includes == "" {
+		cfg.Includes = "_includes"
+	}
+	if cfg.Layouts == "" {
+		cfg.Layouts = "_layouts"
+	}
+	if cfg.Shortcodes == "" {
+		cfg.Shortcodes = "_shortcodes"
+	}
+	if cfg.Port <= 0 {
+		cfg.Port = 4000
+	}
+	if cfg.Permalink == "" {
+		cfg.Permalink = "date"
+	}
+	switch cfg.TemplateEngine {
+	case "", "pongo2", "liquid":
+	default:
+		return fmt.Errorf("template_engine: unknown engine %q", cfg.TemplateEngine)
+	}
+	if cfg.Timezone != "" {
+		cfg.loc, err = time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return fmt.Errorf("timezone: %v", err)
+		}
+	}
+	cfg.Permalink = permalinkStyle(cfg.Permalink)
+	if err := cfg.checkHooks(); err != nil {
+		return err
+	}
+	if err := cfg.checkConversion(); err != nil {
+		return err
+	}
+	if err := cfg.checkGenerators(); err != nil {
+		return err
+	}
+
+	cfg.Source = cfg.abs(cfg.Source)
+	cfg.Destination = cfg.abs(cfg.Destination)
+	cfg.Posts = cfg.abs(cfg.Posts)
+	cfg.Data = cfg.abs(cfg.Data)
+	cfg.Includes = cfg.abs(cfg.Includes)
+	cfg.Layouts = cfg.abs(cfg.Layouts)
+	cfg.Shortcodes = cfg.abs(cfg.Shortcodes)
+	if cfg.CacheDir == "" {
+		cfg.CacheDir = defaultCacheDir
+	}
+	cfg.CacheDir = cfg.abs(cfg.CacheDir)
+	if err := cfg.checkAssets(); err != nil {
+		return err
+	}
+	if err := cfg.checkImages(); err != nil {
+		return err
+	}
+	if err := cfg.checkSass(); err != nil {
+		return err
+	}
+	if err := cfg.checkCompress(); err != nil {
+		return err
+	}
+	if err := cfg.checkSearch(); err != nil {
+		return err
+	}
+	if err := cfg.checkRelated(); err != nil {
+		return err
+	}
+	cfg.vars["site"] = pongo2.Context{}
+	return nil
+}
+
+func (cfg *config) toPageURL(from string, pageVars pongo2.Context) string {
+	return urlJoin(cfg.Baseurl, cfg.toPermalink(cfg.pagePermalink(pageVars), from, pageVars))
+}
+
+func (cfg *config) location() *time.Location {
+	if cfg.loc == nil {
+		return time.Local
+	}
+	return cfg.loc
+}
+
+func (cfg *config) warnf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if cfg.warned == nil {
+		cfg.warned = map[string]bool{}
+	}
+	if cfg.warned[msg] {
+		return
+	}
+	cfg.warned[msg] = true
+	log.Println("Warning:", msg)
+}
+
+// toDate returns the date of the page. The date front matter takes priority,
+// then the date prefix of the file name, then the modification time of the
+// file. The error is non-nil when the date front matter cannot be parsed; the
+// returned date is the fallback in that case.
+func (cfg *config) toDate(from string, pageVars pongo2.Context) (time.Time, error) {
+	var derr error
+	if v, ok := pageVars["date"]; ok && v != nil && v != "" {
+		date, err := parseDate(v, cfg.location())
+		if err == nil {
+			return date, nil
+		}
+		derr = fmt.Errorf("%s: %v", from, err)
+	}
+	name := filepath.Base(from)
+	if len(name) > 11 {
+		date, err := time.ParseInLocation("2006-01-02-", name[:11], cfg.location())
+		if err == nil {
+			return date, derr
+		}
+	}
+	fi, err := cfg.stat(from)
+	if err != nil {
+		return time.Now().In(cfg.location()), derr
+	}
+	return fi.ModTime().In(cfg.location()), derr
+}
+
+// toLastModified returns the last_modified_at front matter of the page, or
+// the zero time if it is not given.
+func (cfg *config) toLastModified(from string, pageVars pongo2.Context) (time.Time, error) {
+	v, ok := pageVars["last_modified_at"]
+	if !ok || v == nil || v == "" {
+		return time.Time{}, nil
+	}
+	date, err := parseDate(v, cfg.location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %v", from, err)
+	}
+	return date, nil
+}
+
+func (cfg *config) toPostURL(from string, pageVars pongo2.Context) string {
+	return urlJoin(cfg.Baseurl, cfg.toPermalink(cfg.postPermalink(pageVars), from, pageVars))
+}
+
+func (cfg *config) toPaginate(n int) string {
+	return filepath.ToSlash(filepath.Join(cfg.Destination, fmt.Sprintf("page%d", n), "index.html"))
+}
+
+func (cfg *config) paginatePages(nposts int) int {
+	return int(math.Floor(float64(nposts) / float64(cfg.Paginate)))
+}
+
+func (cfg *config) toPage(from string, pageVars pongo2.Context) string {
+	return cfg.toOutput(cfg.toPermalink(cfg.pagePermalink(pageVars), from, pageVars))
+}
+
+func (cfg *config) toPost(from string, pageVars pongo2.Context) string {
+	return cfg.toOutput(cfg.toPermalink(cfg.postPermalink(pageVars), from, pageVars))
+}
+
+func (cfg *config) toOutput(permalink string) string {
+	if strings.HasSuffix(permalink, "/") {
+		permalink += "index.html"
+	}
+	return filepath.ToSlash(filepath.Join(cfg.Destination, permalink))
+}
+
+func (cfg *config) isPost(from string) bool {
+	return strings.HasPrefix(from, cfg.Posts+"/")
+}
+
+func (cfg *config) convertFile(ctx context.Context, src, dst string) error {
+	ext := filepath.Ext(src)
+	if !cfg.isConvertable(src) {
+		switch ext {
+		case ".yml", ".go", ".exe":
+			return nil
+		}
+		if page, ok := cfg.virtual[src]; ok {
+			return cfg.writeFile(ctx, src, dst, []byte(page.content))
+		}
+		if set, ok := cfg.images[src]; ok {
+			return cfg.writeImages(ctx, set)
+		}
+		b, err := cfg.readFile(src)
+		if err != nil {
+			return err
+		}
+		return cfg.writeFile(ctx, src, dst, b)
+	}
+
+	if c := cfg.conversionOf(src); c != nil {
+		if err := cfg.convert(ctx, c, src, dst); err != nil {
+			return err
+		}
+		return cfg.postWrite(ctx, src, dst)
+	}
+
+	if cfg.isSass(src) {
+		return cfg.compileSass(ctx, src, dst)
+	}
+
+	output, err := cfg.render(ctx, src)
+	if err != nil {
+		return err
+	}
+	if cfg.hasHooks(PostRender) {
+		e := &Event{Name: PostRender, Path: src, URL: cfg.destURL(dst), Dest: dst, Content: output}
+		if err := cfg.fire(ctx, e); err != nil {
+			return err
+		}
+		output = e.Content
+	}
+	return cfg.writeFile(ctx, src, dst, []byte(output))
+}
+
+// render renders the page or post src through its layouts.
+func (cfg *config) render(ctx context.Context, src string) (string, error) {
+	from := src
+	first := true
+	inLayout := false
+	vars := pongo2.Context{"content": ""}
+	blocks := pongo2.Context{}
+	var layouts []string
+	for {
+		for k, v := range cfg.vars {
+			vars[k] = v
+		}
+		pageVars := pongo2.Context{}
+		content, err := cfg.parseFile(src, pageVars)
+		if err != nil {
+			return "", err
+		}
+		for k, v := range pageVars {
+			vars[k] = v
+		}
+		if first {
+			first = false
+			date, err := cfg.toDate(src, vars)
+			if err != nil {
+				cfg.warnf("%v", err)
+			}
+			lastModified, err := cfg.toLastModified(src, vars)
+			if err != nil {
+				cfg.warnf("%v", err)
+			}
+			var pageURL string
+			if cfg.isPost(src) {
+				pageURL = cfg.toPostURL(src, pageVars)
+			} else {
+				pageURL = cfg.toPageURL(src, pageVars)
+			}
+			page := pongo2.Context{}
+			page.Update(pageVars)
+			page["path"] = src
+			page["date"] = date
+			page["url"] = pageURL
+			page["title"] = str(vars["title"])
+			for name, b := range frontMatterBlocks(pageVars) {
+				blocks[name] = b
+			}
+			page["blocks"] = blocks
+			if !lastModified.IsZero() {
+				page["last_modified_at"] = lastModified
+			}
+			if related, ok := cfg.related[src]; ok {
+				page["related_posts"] = related
+			}
+			vars["post"] = page
+			vars["page"] = page
+			if cfg.hasHooks(PreRender) {
+				e := &Event{Name: PreRender, Path: src, URL: pageURL, Page: page, Content: content}
+				if err := cfg.fire(ctx, e); err != nil {
+					return "", err
+				}
+				content = e.Content
+			}
+		}
+		var shortcodes []string
+		if !inLayout && cfg.isMarkdown(src) {
+			content, shortcodes, err = cfg.expandShortcodes(src, content)
+			if err != nil {
+				return "", err
+			}
+		}
+		convertable := true
+		if v, ok := vars["convertable"].(bool); ok {
+			convertable = v
+		}
+		newvars := pongo2.Context{}
+		newvars.Update(cfg.vars)
+		newvars.Update(vars)
+		if !inLayout && str(vars["layout"]) != "" && !extendsTag.MatchString(content) {
+			// Block sections of the page fill the blocks of the layout.
+			var sections map[string]string
+			content, sections = extractBlocks(content)
+			for name, section := range sections {
+				if convertable {
+					section, err = cfg.engine().renderString(src, section, newvars)
+					if err != nil {
+						return "", fmt.Errorf("%s: block %s: %v", src, name, err)
+					}
+				}
+				if cfg.isMarkdown(src) {
+					section = restoreShortcodes(markdownify(section), shortcodes)
+				}
+				blocks[name] = section
+			}
+		}
+		if convertable && content != "" {
+			var output string
+			if inLayout {
+				output, err = cfg.engine().renderLayout(src, blocks, newvars)
+			} else {
+				output, err = cfg.engine().renderString(src, content, newvars)
+			}
+			if err == nil && output != "" {
+				content = output
+			} else {
+				return "", fmt.Errorf("%s: %v", src, err)
+			}
+		}
+		if cfg.isMarkdown(src) {
+			vars["content"] = restoreShortcodes(markdownify(content), shortcodes)
+		} else {
+			vars["content"] = content
+		}
+		cfg.markSafe(str(vars["content"]))
+		if !inLayout {
+			cfg.recordRendered(from, str(vars["content"]))
+		}
+		if str(vars["layout"]) == "" || str(vars["layout"]) == "nil" {
+			break
+		}
+		layouts = append(layouts, str(vars["layout"]))
+		for _, layout := range layouts[:len(layouts)-1] {
+			if layout == str(vars["layout"]) {
+				return "", fmt.Errorf("%s: layout cycle: %s", from, strings.Join(layouts, " -> "))
+			}
+		}
+		src = cfg.lookup(cfg.Layouts, cfg.themeLayouts, str(vars["layout"])+".html")
+		content = str(vars["content"])
+		vars["content"] = content
+		vars["page"].(pongo2.Context)["content"] = content
+		vars["layout"] = ""
+		inLayout = true
+	}
+
+	return str(vars["content"]), nil
+}
+
+func (cfg *config) newPost(p string) error {
+	if p == "" {
+		p = "new-post"
+	}
+	f := filepath.Join(cfg.Posts, time.Now().Format("2006-01-02-"+p+".md"))
+	return ioutil.WriteFile(f, []byte(newPost), 0644)
+}
+
+// build reads the site and writes it to the destination.
+func (cfg *config) build(ctx context.Context) error {
+	buildMu.Lock()
+	defer buildMu.Unlock()
+	if err := cfg.read(ctx); err != nil {
+		return err
+	}
+	if err := cfg.write(ctx); err != nil {
+		return err
+	}
+	return cfg.fire(ctx, &Event{Name: PostBuild})
+}
+
+// convertChanged converts the file changed from to to, without reading the
+// site again. The filters and tags are registered again, as another site
+// may have been built since.
+func (cfg *config) convertChanged(ctx context.Context, from, to string) error {
+	buildMu.Lock()
+	defer buildMu.Unlock()
+	pongoSetup(cfg)
+	return cfg.convertFile(ctx, from, to)
+}
+
+// read reads the posts, pages and data of the site, and runs the generators.
+func (cfg *config) read(ctx context.Context) error {
+	pongoSetup(cfg)
+	cfg.virtual = map[string]virtualPage{}
+	cfg.generated = nil
+	cfg.outputs = nil
+	cfg.extends = nil
+	cfg.safeHTML = nil
+	cfg.rendered = nil
+	if cfg.Search.Path != "" {
+		cfg.rendered = map[string]string{}
+	}
+
+	var err error
+	pages := []pongo2.Context{}
+	// Files of the site override the same files of the theme.
+	seen := map[string]bool{}
+	inputs := cfg.bundleInputs()
+	for _, source := range cfg.sourceDirs() {
+		err = cfg.walk(source, func(from string, info fs.DirEntry, err error) error {
+			if info == nil || from == source {
+				return err
+			}
+
+			dot := path.Base(from)[0]
+			if info.IsDir() {
+				if from == cfg.Destination || dot == '.' || dot == '_' {
+					return filepath.SkipDir
+				}
+			} else {
+				for _, exclude := range cfg.Exclude {
+					if strings.HasSuffix(from, exclude) {
+						return err
+					}
+				}
+				if dot != '.' && dot != '_' && !seen[cfg.sourceRel(from)] && !inputs[from] {
+					seen[cfg.sourceRel(from)] = true
+					vars := pongo2.Context{}
+					if cfg.isConvertable(from) {
+						content, err := cfg.parseFile(from, vars)
+						if err != nil {
+							return err
+						}
+						if _, err := cfg.postLoad(ctx, from, vars, content); err != nil {
+							return err
+						}
+					}
+					vars["path"] = from
+					vars["url"] = cfg.toPageURL(from, vars)
+					vars["date"], err = cfg.toDate(from, vars)
+					if err != nil {
+						cfg.warnf("%v", err)
+					}
+					pages = append(pages, vars)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	categories := pongo2.Context{}
+	posts := []pongo2.Context{}
+	err = cfg.walk(cfg.Posts, func(from string, info fs.DirEntry, err error) error {
+		if info == nil || from == cfg.Posts {
+			return err
+		}
+		if info.IsDir() {
+			return err
+		}
+		if !cfg.isConvertable(from) {
+			return err
+		}
+		vars := pongo2.Context{}
+		content, err := cfg.parseFile(from, vars)
+		if err != nil {
+			return err
+		}
+		content, err = cfg.postLoad(ctx, from, vars, content)
+		if err != nil {
+			return err
+		}
+		vars["path"] = from
+		vars["url"] = cfg.toPostURL(from, vars)
+		vars["date"], err = cfg.toDate(from, vars)
+		if err != nil {
+			cfg.warnf("%v", err)
+		}
+		lastModified, err := cfg.toLastModified(from, vars)
+		if err != nil {
+			cfg.warnf("%v", err)
+		} else if !lastModified.IsZero() {
+			vars["last_modified_at"] = lastModified
+		}
+		vars["content"] = content
+		cfg.markSafe(content)
+		if category, ok := vars["category"]; ok {
+			cname := str(category)
+			categorizedPosts := categories[cname]
+			if categorizedPosts == nil {
+				categorizedPosts = []pongo2.Context{}
+			}
+			categorizedPosts = append(categorizedPosts.([]pongo2.Context), vars)
+			categories[cname] = categorizedPosts
+		}
+		posts = append(posts, vars)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Sort(sort.Reverse(Posts(posts)))
+	for _, category := range categories {
+		sort.Sort(sort.Reverse(Posts(category.([]pongo2.Context))))
+	}
+	sort.Sort(sort.Reverse(Posts(pages)))
+
+	if cfg.LimitPosts > 0 && len(posts) > cfg.LimitPosts {
+		posts = posts[:cfg.LimitPosts]
+	}
+	cfg.relatePosts(posts)
+
+	if cfg.Title == "" {
+		cfg.Title = cfg.Name
+	}
+
+	cfg.vars["site"].(pongo2.Context)["title"] = cfg.Title
+	cfg.vars["site"].(pongo2.Context)["name"] = cfg.Name
+	cfg.vars["site"].(pongo2.Context)["url"] = cfg.Baseurl
+	cfg.vars["site"].(pongo2.Context)["baseurl"] = cfg.Baseurl
+	cfg.vars["site"].(pongo2.Context)["time"] = time.Now().In(cfg.location())
+	cfg.vars["site"].(pongo2.Context)["pages"] = pages
+	cfg.vars["site"].(pongo2.Context)["posts"] = posts
+	cfg.vars["site"].(pongo2.Context)["categories"] = categories
+	cfg.vars["site"].(pongo2.Context)["data"] = pongo2.Context{}
+	if cfg.Search.Path != "" {
+		cfg.vars["site"].(pongo2.Context)["search_index"] = urlJoin(cfg.Baseurl, cfg.searchDest()[len(cfg.Destination):])
+	}
+
+	for _, dir := range cfg.dataDirs() {
+		fis, err := cfg.readDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, fi := range fis {
+			ext := filepath.Ext(fi.Name())
+			var data interface{}
+			switch ext {
+			case ".yaml", ".yml":
+				b, err := cfg.readFile(path.Join(dir, fi.Name()))
+				if err != nil {
+					return err
+				}
+				err = yaml.Unmarshal(b, &data)
+				if err == nil {
+					name := fi.Name()
+					name = name[0 : len(name)-len(ext)]
+					cfg.vars["site"].(pongo2.Context)["data"].(pongo2.Context)[name] = data
+				}
+			}
+		}
+	}
+
+	pages, err = cfg.runGenerators(ctx, pages, posts)
+	if err != nil {
+		return err
+	}
+	cfg.vars["site"].(pongo2.Context)["pages"] = pages
+	if err := cfg.buildBundles(); err != nil {
+		return err
+	}
+	if err := cfg.indexAssets(pages); err != nil {
+		return err
+	}
+	if err := cfg.processImages(pages); err != nil {
+		return err
+	}
+	cfg.indexLinks(posts, pages)
+
+	if err := cfg.checkOutputs(posts, pages); err != nil {
+		if !cfg.WarnCollisions {
+			return err
+		}
+		log.Println("Warning:", err)
+	}
+	cfg.posts = posts
+	cfg.pages = pages
+	return nil
+}
+
+// write renders the posts and pages read by read to the destination.
+func (cfg *config) write(ctx context.Context) error {
+	posts, pages := cfg.posts, cfg.pages
+	if cfg.toDisk() {
+		if err := os.MkdirAll(cfg.Destination, 0755); err != nil {
+			return err
+		}
+	}
+
+	for _, post := range posts {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		from := post["path"].(string)
+		to := cfg.toPost(from, post)
+		fmt.Fprintln(cfg.out(), from, "=>", to)
+		if err := cfg.convertFile(ctx, from, to); err != nil {
+			return fmt.Errorf("%s: %v", from, err)
+		}
+	}
+
+	cfg.vars["paginator"] = pongo2.Context{}
+	if cfg.Paginate > 0 {
+		nni := cfg.Paginate
+		if nni > len(posts) {
+			nni = len(posts)
+		}
+		cfg.vars["paginator"].(pongo2.Context)["per_page"] = cfg.Paginate
+		cfg.vars["paginator"].(pongo2.Context)["total_pages"] = len(posts)
+		cfg.vars["paginator"].(pongo2.Context)["total_posts"] = len(posts)
+		cfg.vars["paginator"].(pongo2.Context)["posts"] = posts[:nni]
+		if len(posts) > cfg.Paginate {
+			cfg.vars["paginator"].(pongo2.Context)["next_page"] = true
+			cfg.vars["paginator"].(pongo2.Context)["next_page_path"] = "/page2/"
+		}
+	}
+
+	var index pongo2.Context
+	// The images may be used by the image tag of the pages, and are written
+	// after them so that they are not copied and then stripped.
+	var images []pongo2.Context
+	for _, page := range pages {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		from := page["path"].(string)
+		if _, ok := cfg.images[from]; !ok && isImage(from) {
+			images = append(images, page)
+			continue
+		}
+		to := cfg.pageDest(from, page)
+		fmt.Fprintln(cfg.out(), from, "=>", to)
+		if err := cfg.convertFile(ctx, from, to); err != nil {
+			return fmt.Errorf("%s: %v", from, err)
+		}
+
+		switch "/" + cfg.sourceRel(from) {
+		case "/index.md", "/index.html":
+			index = page
+		}
+	}
+
+	if cfg.Paginate > 0 && index != nil {
+		cfg.vars["paginator"].(pongo2.Context)["previous_page"] = nil
+		cfg.vars["paginator"].(pongo2.Context)["next_page"] = nil
+
+		from := index["path"].(string)
+		npages := cfg.paginatePages(len(posts))
+		for i := 0; i < npages; i++ {
+			if i < npages-1 {
+				cfg.vars["paginator"].(pongo2.Context)["next_page"] = true
+				cfg.vars["paginator"].(pongo2.Context)["next_page_path"] = fmt.Sprintf("/page%d/", i+1)
+			} else {
+				cfg.vars["paginator"].(pongo2.Context)["next_page"] = false
+			}
+			if i > 0 {
+				cfg.vars["paginator"].(pongo2.Context)["previous_page"] = true
+				cfg.vars["paginator"].(pongo2.Context)["previous_page_path"] = fmt.Sprintf("/page%d/", i+1)
+			} else {
+				cfg.vars["paginator"].(pongo2.Context)["previous_page"] = false
+			}
+			nni := cfg.Paginate * (i + 1)
+			if nni > len(posts) {
+				nni = len(posts)
+			}
+			cfg.vars["paginator"].(pongo2.Context)["posts"] = posts[cfg.Paginate*i : nni]
+
+			to := cfg.toPaginate(i)
+			fmt.Fprintln(cfg.out(), from, "=>", to)
+			if err := cfg.convertFile(ctx, from, to); err != nil {
+				return fmt.Errorf("%s: %v", from, err)
+			}
+		}
+	}
+
+	for _, page := range images {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		from := page["path"].(string)
+		if set, ok := cfg.images[from]; ok && set.written {
+			continue
+		}
+		to := cfg.pageDest(from, page)
+		fmt.Fprintln(cfg.out(), from, "=>", to)
+		if err := cfg.convertFile(ctx, from, to); err != nil {
+			return fmt.Errorf("%s: %v", from, err)
+		}
+	}
+
+	// The images of the image tag are known only after rendering.
+	for _, name := range cfg.imageNames() {
+		set := cfg.images[name]
+		if set.written {
+			continue
+		}
+		fmt.Fprintln(cfg.out(), name, "=>", set.outputs[len(set.outputs)-1].to)
+		if err := cfg.writeImages(ctx, set); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+
+	for _, name := range cfg.bundleNames() {
+		b := cfg.bundles[name]
+		fmt.Fprintln(cfg.out(), "(asset bundle "+name+") =>", b.to)
+		if err := cfg.writeFile(ctx, "", b.to, b.data); err != nil {
+			return err
+		}
+	}
+
+	manifest, err := cfg.manifest()
+	if err != nil {
+		return err
+	}
+	if manifest != nil {
+		to := cfg.manifestDest()
+		fmt.Fprintln(cfg.out(), to)
+		if err := cfg.writeFile(ctx, "", to, manifest); err != nil {
+			return err
+		}
+	}
+
+	if err := cfg.writeSearch(ctx); err != nil {
+		return err
+	}
+
+	sitemap := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.sitemaps.org/schemas/sitemap/0.9 http://www.sitemaps.org/schemas/sitemap/0.9/sitemap.xsd" xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+{% for post in site.posts | limit:25 %}
+<url>
+<loc>{{ post.url | xml_escape }}</loc>
+<lastmod>{{ post.date | date:"%Y-%m-%dT%H:%M:%S%z" }}</lastmod>
+</url>
+{% endfor %}
+</urlset>
+`
+
+	to := filepath.ToSlash(filepath.Join(cfg.Destination, "sitemap.xml"))
+	fmt.Fprintln(cfg.out(), to)
+	tpl, err := cfg.templateSet().FromString(sitemap)
+	if err != nil {
+		return err
+	}
+	newvars := pongo2.Context{}
+	newvars.Update(cfg.vars)
+	output, err := tpl.Execute(newvars)
+	if err != nil {
+		return err
+	}
+	if err := cfg.writeFile(ctx, "", to, []byte(output)); err != nil {
+		return err
+	}
+
+	return cfg.writeGenerated(ctx)
+}
+
+// outputOwner is the source file and the URL of an output.
+type outputOwner struct {
+	from string
+	url  string
+}
+
+// checkOutputs reports the files which would be written to the same path of
+// the destination, with the source files and URLs which produce them. The
+// outputs are kept for claimOutput.
+func (cfg *config) checkOutputs(posts, pages []pongo2.Context) error {
+	outputs := map[string]outputOwner{}
+	var collisions []string
+	claim := func(to, from, url string) {
+		if o, ok := outputs[to]; ok {
+			collisions = append(collisions, fmt.Sprintf("%s is written by both %s (%s) and %s (%s)", to, o.from, o.url, from, url))
+			return
+		}
+		outputs[to] = outputOwner{from: from, url: url}
+	}
+	defer func() {
+		cfg.outputs = outputs
+	}()
+
+	var index pongo2.Context
+	for _, post := range posts {
+		from := post["path"].(string)
+		claim(cfg.toPost(from, post), from, str(post["url"]))
+	}
+	for _, page := range pages {
+		from := page["path"].(string)
+		switch filepath.Ext(from) {
+		case ".yml", ".go", ".exe":
+			continue
+		}
+		claim(cfg.pageDest(from, page), from, str(page["url"]))
+		if cfg.isSass(from) && cfg.Sass.Sourcemap == "always" {
+			claim(cfg.pageDest(from, page)+".map", from, str(page["url"])+".map")
+		}
+		switch "/" + cfg.sourceRel(from) {
+		case "/index.md", "/index.html":
+			index = page
+		}
+	}
+	if cfg.Paginate > 0 && index != nil {
+		for i := 0; i < cfg.paginatePages(len(posts)); i++ {
+			to := cfg.toPaginate(i)
+			claim(to, index["path"].(string), urlJoin(cfg.Baseurl, to[len(cfg.Destination):]))
+		}
+	}
+	claim(filepath.ToSlash(filepath.Join(cfg.Destination, "sitemap.xml")), "(generated sitemap)", urlJoin(cfg.Baseurl, "/sitemap.xml"))
+	for _, f := range cfg.generated {
+		claim(f.to, f.from, urlJoin(cfg.Baseurl, f.to[len(cfg.Destination):]))
+	}
+	for _, name := range cfg.bundleNames() {
+		b := cfg.bundles[name]
+		claim(b.to, "(asset bundle "+name+")", b.url)
+	}
+	for _, name := range cfg.imageNames() {
+		set := cfg.images[name]
+		for _, o := range set.outputs[:len(set.outputs)-1] {
+			claim(o.to, name, o.url)
+		}
+	}
+	if cfg.Assets.Fingerprint {
+		to := cfg.manifestDest()
+		claim(to, "(asset manifest)", urlJoin(cfg.Baseurl, to[len(cfg.Destination):]))
+	}
+	if cfg.Search.Path != "" {
+		to := cfg.searchDest()
+		claim(to, "(search index)", urlJoin(cfg.Baseurl, to[len(cfg.Destination):]))
+		for _, shard := range cfg.searchShards(len(cfg.searchPages(posts, pages))) {
+			claim(shard, "(search index)", urlJoin(cfg.Baseurl, shard[len(cfg.Destination):]))
+		}
+	}
+
+	if len(collisions) > 0 {
+		return fmt.Errorf("permalink collision:\n\t%s", strings.Join(collisions, "\n\t"))
+	}
+	return nil
+}
+
+// claimOutput reports the output which is known only while rendering, such
+// as a variant of an image of the image tag, if it collides with the outputs
+// of checkOutputs.
+func (cfg *config) claimOutput(to, from, url string) error {
+	if o, ok := cfg.outputs[to]; ok && o.from != from {
+		err := fmt.Errorf("permalink collision:\n\t%s is written by both %s (%s) and %s (%s)", to, o.from, o.url, from, url)
+		if !cfg.WarnCollisions {
+			return err
+		}
+		log.Println("Warning:", err)
+		return nil
+	}
+	cfg.outputs[to] = outputOwner{from: from, url: url}
+	return nil
+}
+
+// serve builds the site, serves the destination and rebuilds the files
+// changed until ctx is done.
+func (cfg *config) serve(ctx context.Context) error {
+	if cfg.Baseurl != "" {
+		if u, err := url.Parse(cfg.Baseurl); err == nil {
+			host := cfg.Host
+			if host == "" {
+				host = "localhost"
+			}
+			u.Host = fmt.Sprintf("%s:%d", host, cfg.Port)
+			cfg.Baseurl = u.String()
+		}
+	}
+
+	err := cfg.build(ctx)
+	if err != nil {
+		return err
+	}
+
+	handler := cfg.compressedHandler(http.FileServer(http.Dir(cfg.Destination)), cfg.readDest)
+	if h, ok := cfg.output.(http.Handler); ok {
+		handler = h
+		if m, ok := h.(*MemoryOutput); ok {
+			handler = cfg.compressedHandler(m, m.ReadFile)
+		}
+	}
+	if cfg.onDisk {
+		if err := cfg.watch(ctx); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Lisning at %s:%d\n", cfg.Host, cfg.Port)
+	server := &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Handler: handler,
+	}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	err = server.ListenAndServe()
+	if err == http.ErrServerClosed && ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// watch rebuilds the files changed in the source directory until ctx is
+// done.
+func (cfg *config) watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	err = filepath.Walk(cfg.Source, func(name string, info os.FileInfo, err error) error {
+		if info == nil || name == cfg.Destination {
+			return err
+		}
+		if info.IsDir() {
+			if filepath.HasPrefix(name, ".") || filepath.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			err = watcher.WatchFlags(name, fsnotify.FSN_ALL)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	go func() {
+		fired := false
+		for {
+			select {
+			case <-ctx.Done():
+				watcher.Close()
+				return
+			case e := <-watcher.Event:
+				from := filepath.ToSlash(e.Name)
+				if filepath.HasPrefix(from, cfg.Destination) {
+					continue
+				}
+				to := ""
+
+				// Hooks may change the pages read, which are kept until the
+				// next build.
+				rebuild := cfg.isTemplate(from) || cfg.hasHooks(PostLoad)
+				// The URLs of the assets depend on their content.
+				rebuild = rebuild || len(cfg.Assets.Bundles) > 0 || cfg.Assets.Fingerprint
+				// The variants of the images are named by their widths.
+				rebuild = rebuild || isImage(from)
+				// The partials of Sass are imported by the other files.
+				rebuild = rebuild || cfg.isSass(from)
+				// The search index has the content of all the pages.
+				rebuild = rebuild || cfg.Search.Path != "" && cfg.isConvertable(from)
+				// The related posts depend on the tags, categories and
+				// content of all the posts.
+				rebuild = rebuild || cfg.isPost(from)
+				if rebuild {
+					buildMu.Lock()
+					cfg.engine().cleanCache()
+					buildMu.Unlock()
+				} else {
+					vars := pongo2.Context{}
+					_, err = cfg.parseFile(from, vars)
+					if err != nil {
+						continue
+					}
+					if filepath.HasPrefix(from, cfg.Posts) {
+						to = cfg.toPost(from, vars)
+					} else if filepath.HasPrefix(from, cfg.Source) {
+						to = cfg.toPage(from, vars)
+					}
+				}
+				if to != "" || rebuild {
+					if !fired {
+						fired = true
+						go func(from, to string) {
+							fired = false
+							select {
+							case <-time.After(100 * time.Millisecond):
+								fired = false
+								if to == "" {
+									fmt.Fprintln(cfg.out(), from, "changed, rebuilding")
+									if err := cfg.build(ctx); err != nil {
+										log.Println("Error:", err)
+									}
+									return
+								}
+								fmt.Fprintln(cfg.out(), from, "=>", to)
+								if err := cfg.convertChanged(ctx, from, to); err != nil {
+									log.Println("Error:", err)
+								}
+							}
+						}(from, to)
+					}
+				}
+			case err := <-watcher.Error:
+				log.Println("Error:", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// out returns the writer where the files written are reported.
+func (cfg *config) out() io.Writer {
+	if cfg.stdout == nil {
+		return os.Stdout
+	}
+	return cfg.stdout
+}
+
+func (cfg *config) parseFile(file string, vars pongo2.Context) (string, error) {
+	if page, ok := cfg.virtual[file]; ok {
+		vars.Update(page.vars)
+		return page.content, nil
+	}
+	b, err := cfg.readFile(file)
+	if err != nil {
+		return "", err
+	}
+	content := string(b)
+	lines := strings.Split(content, "\n")
+	if len(lines) > 2 && lines[0] == "---" {
+		var n int
+		var line string
+		for n, line = range lines[1:] {
+			if line == "---" {
+				break
+			}
+		}
+		err = yaml.Unmarshal(b, &vars)
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", file, err)
+		}
+		content = strings.Join(lines[n+2:], "\n")
+	} else if cfg.isMarkdown(file) {
+		vars["title"] = ""
+		vars["date"] = ""
+	}
+	return content, nil
+}
+
+func (cfg *config) isMarkdown(src string) bool {
+	ext := filepath.Ext(src)
+	if ext == "" {
+		return false
+	}
+	if cfg.MarkdownExt != "" {
+		for _, v := range strings.Split(cfg.MarkdownExt, ",") {
+			if ext == "."+v {
+				return true
+			}
+		}
+		return false
+	}
+	switch ext {
+	case ".md", ".mkd", ".markdown":
+		return true
+	}
+	return false
+}
+
+func (cfg *config) isConvertable(src string) bool {
+	if cfg.isMarkdown(src) {
+		return true
+	}
+	ext := filepath.Ext(src)
+	switch ext {
+	case ".html", ".xml":
+		return true
+	}
+	return cfg.conversionOf(src) != nil || cfg.isSass(src)
+}
@@ -0,0 +1,217 @@
+package site
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/flosch/pongo2"
+)
+
+// defaultCacheDir is the directory where the outputs of the conversions are
+// cached, relative to the working directory.
+const defaultCacheDir = ".jedie-cache"
+
+// CacheStats are the statistics of the conversion cache.
+type CacheStats struct {
+	// Dir is the cache directory.
+	Dir string
+	// Entries is the number of outputs cached.
+	Entries int
+	// Size is the total size of the outputs cached in bytes.
+	Size int64
+}
+
+// cacheDir returns the cache directory, or an empty string if the outputs of
+// the conversions are not cached. The cache is used only for sites read from
+// the disk.
+func (cfg *config) cacheDir() string {
+	if cfg.NoCache || !cfg.onDisk {
+		return ""
+	}
+	return cfg.CacheDir
+}
+
+// conversionKey returns the key of the output of the conversion of src to
+// dst: the hash of the content of src and the command lines of the
+// conversion.
+func (cfg *config) conversionKey(c *conversion, src, dst string) (string, error) {
+	b, err := cfg.readFile(src)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	write := func(s string) {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	write("jedie conversion 1")
+	write(c.Ext)
+	if c.Command != "" {
+		command, err := cfg.expandCommand(c.Command, pongo2.Context{"from": src, "to": dst})
+		if err != nil {
+			return "", err
+		}
+		write(command)
+	}
+	writeEnv := func(env map[string]string) {
+		keys := make([]string, 0, len(env))
+		for k := range env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			write(k + "=" + env[k])
+		}
+	}
+	writeEnv(c.Env)
+	for _, f := range c.Filters {
+		write("filter")
+		for _, arg := range f.Command {
+			s, err := cfg.expandCommand(arg, pongo2.Context{"from": src})
+			if err != nil {
+				return "", err
+			}
+			write(s)
+		}
+		writeEnv(f.Env)
+	}
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func cachePath(dir, key string) string {
+	return filepath.Join(dir, key[:2], key)
+}
+
+// cacheGet returns the output cached for the key.
+func (cfg *config) cacheGet(key string) ([]byte, bool) {
+	b, err := ioutil.ReadFile(cachePath(cfg.cacheDir(), key))
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// cachePut caches the output for the key. The file is renamed into place so
+// that an interrupted build leaves no partial output.
+func (cfg *config) cachePut(key string, data []byte) error {
+	p := cachePath(cfg.cacheDir(), key)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(p), key+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// isCacheEntry returns true if the file name in the directory dir of the
+// cache is an output cached or a temporary file of cachePut.
+func isCacheEntry(dir, name string) bool {
+	key := name
+	if i := strings.Index(name, ".tmp"); i >= 0 {
+		key = name[:i]
+	}
+	if len(key) != sha256.Size*2 || key[:2] != dir {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
+
+// walkCache calls fn with the files of the cache directory written by
+// cachePut. The other files are left alone.
+func (cfg *config) walkCache(fn func(name string, info os.FileInfo, tmp bool) error) error {
+	dirs, err := ioutil.ReadDir(cfg.CacheDir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 {
+			continue
+		}
+		d := filepath.Join(cfg.CacheDir, dir.Name())
+		fis, err := ioutil.ReadDir(d)
+		if err != nil {
+			return err
+		}
+		for _, fi := range fis {
+			if !fi.Mode().IsRegular() || !isCacheEntry(dir.Name(), fi.Name()) {
+				continue
+			}
+			if err := fn(filepath.Join(d, fi.Name()), fi, strings.Contains(fi.Name(), ".tmp")); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// cacheStats returns the statistics of the cache directory.
+func (cfg *config) cacheStats() (CacheStats, error) {
+	stats := CacheStats{Dir: cfg.CacheDir}
+	err := cfg.walkCache(func(name string, info os.FileInfo, tmp bool) error {
+		if !tmp {
+			stats.Entries++
+			stats.Size += info.Size()
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// clearCache removes the outputs cached. The cache directory is refused if
+// it is the source directory, or has the source or destination directory
+// in it, as it may be set to any directory in the config.
+func (cfg *config) clearCache() error {
+	if !cfg.onDisk {
+		return nil
+	}
+	if cfg.CacheDir == "" {
+		return fmt.Errorf("cache_dir: not set")
+	}
+	dir, err := filepath.Abs(cfg.CacheDir)
+	if err != nil {
+		return err
+	}
+	for _, p := range []string{cfg.Source, cfg.Destination} {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		if rel, err := filepath.Rel(dir, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("cache_dir: %s has %s in it; refusing to clear", cfg.CacheDir, p)
+		}
+	}
+	dirs := map[string]bool{}
+	err = cfg.walkCache(func(name string, info os.FileInfo, tmp bool) error {
+		dirs[filepath.Dir(name)] = true
+		return os.Remove(name)
+	})
+	if err != nil {
+		return err
+	}
+	// The directories of the keys are removed if nothing else is in them.
+	for d := range dirs {
+		os.Remove(d)
+	}
+	return nil
+}
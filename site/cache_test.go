@@ -0,0 +1,53 @@
+package site
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClearCache(t *testing.T) {
+	for _, dir := range []string{".", "..", "_site", ""} {
+		site, cfg := makeSite("cache_dir: "+dir, map[string]string{"index.html": "hello"})
+		if dir == "" {
+			cfg.CacheDir = ""
+		}
+		s := &Site{cfg: cfg, hooks: map[string][]Hook{}}
+		if err := s.ClearCache(); err == nil || !strings.HasPrefix(err.Error(), "cache_dir: ") {
+			t.Errorf("%q: want a cache_dir error but got %v", dir, err)
+		}
+		if _, err := os.Stat(filepath.Join(site, "index.html")); err != nil {
+			t.Errorf("%q: want the site kept but got %v", dir, err)
+		}
+		os.RemoveAll(site)
+	}
+
+	site, cfg := makeSite("", nil)
+	defer os.RemoveAll(site)
+	s := &Site{cfg: cfg, hooks: map[string][]Hook{}}
+	key := strings.Repeat("ab", 32)
+	if err := cfg.cachePut(key, []byte("cached")); err != nil {
+		t.Fatal(err)
+	}
+	notes := filepath.Join(cfg.CacheDir, "notes.txt")
+	if err := ioutil.WriteFile(notes, []byte("mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if stats, err := s.CacheStats(); err != nil || stats.Entries != 1 {
+		t.Fatalf("want 1 entry but got %v, %v", stats, err)
+	}
+	if err := s.ClearCache(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cachePath(cfg.CacheDir, key)); !os.IsNotExist(err) {
+		t.Fatalf("want the entry removed but got %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(cachePath(cfg.CacheDir, key))); !os.IsNotExist(err) {
+		t.Fatalf("want the directory of the entry removed but got %v", err)
+	}
+	if _, err := os.Stat(notes); err != nil {
+		t.Fatalf("want the other files kept but got %v", err)
+	}
+}
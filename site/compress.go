@@ -0,0 +1,231 @@
+package site
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compress configures the compressed copies of the outputs, written next to
+// them for the servers serving precompressed files, such as index.html.gz:
+//
+//	compress:
+//	  formats: [gzip, br, zstd]
+//	  min_size: 1024
+//	  exts: [html, css, js, xml, json]
+//
+// MinSize is 1024 if not given, and 0 compresses every output.
+type compress struct {
+	Formats []string `yaml:"formats"`
+	MinSize *int     `yaml:"min_size"`
+	Exts    []string `yaml:"exts"`
+}
+
+// encoding is a format of the compressed copies.
+type encoding struct {
+	// name is the name of the format in Content-Encoding.
+	name string
+	ext  string
+	// encode compresses data at the best level.
+	encode func(w io.Writer, data []byte) error
+}
+
+var encodings = map[string]encoding{
+	"gzip": {"gzip", ".gz", func(w io.Writer, data []byte) error {
+		zw, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+		if err != nil {
+			return err
+		}
+		if _, err := zw.Write(data); err != nil {
+			return err
+		}
+		return zw.Close()
+	}},
+	"br": {"br", ".br", func(w io.Writer, data []byte) error {
+		bw := brotli.NewWriterLevel(w, brotli.BestCompression)
+		if _, err := bw.Write(data); err != nil {
+			return err
+		}
+		return bw.Close()
+	}},
+	"zstd": {"zstd", ".zst", func(w io.Writer, data []byte) error {
+		zw, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+		if err != nil {
+			return err
+		}
+		if _, err := zw.Write(data); err != nil {
+			return err
+		}
+		return zw.Close()
+	}},
+}
+
+// checkCompress checks the config of the compression, and sets the
+// defaults. brotli is also accepted for br.
+func (cfg *config) checkCompress() error {
+	for i, f := range cfg.Compress.Formats {
+		if f == "brotli" {
+			cfg.Compress.Formats[i] = "br"
+		} else if _, ok := encodings[f]; !ok {
+			return fmt.Errorf("compress: unknown format %q", f)
+		}
+	}
+	if cfg.Compress.MinSize == nil {
+		size := 1024
+		cfg.Compress.MinSize = &size
+	}
+	if *cfg.Compress.MinSize < 0 {
+		return fmt.Errorf("compress: min_size must not be negative")
+	}
+	if len(cfg.Compress.Exts) == 0 {
+		cfg.Compress.Exts = []string{"html", "css", "js", "xml", "json"}
+	}
+	return nil
+}
+
+// isCompressed returns true if the output is compressed by its extension.
+func (cfg *config) isCompressed(name string) bool {
+	ext := strings.TrimPrefix(strings.ToLower(path.Ext(name)), ".")
+	for _, e := range cfg.Compress.Exts {
+		if strings.TrimPrefix(e, ".") == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCompressed writes the compressed copies of the output name, relative
+// to the destination. The copies not smaller than the output are skipped,
+// and removed if written by a previous build.
+func (cfg *config) writeCompressed(name string, data []byte) error {
+	if len(cfg.Compress.Formats) == 0 || !cfg.isCompressed(name) {
+		return nil
+	}
+	for _, f := range cfg.Compress.Formats {
+		e := encodings[f]
+		var b []byte
+		if len(data) >= *cfg.Compress.MinSize {
+			var err error
+			if b, err = cfg.encode(e, data); err != nil {
+				return fmt.Errorf("compress: %s: %v", name, err)
+			}
+		}
+		if b == nil || len(b) >= len(data) {
+			if cfg.toDisk() {
+				err := os.Remove(filepath.Join(cfg.Destination, filepath.FromSlash(name+e.ext)))
+				if err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
+			continue
+		}
+		if err := cfg.dest().WriteFile(name+e.ext, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encode compresses data, cached by its content as the best levels are
+// slow.
+func (cfg *config) encode(e encoding, data []byte) ([]byte, error) {
+	var key string
+	if cfg.cacheDir() != "" {
+		h := sha256.New()
+		fmt.Fprintf(h, "jedie compress 1\x00%s\x00", e.name)
+		h.Write(data)
+		key = hex.EncodeToString(h.Sum(nil))
+		if b, ok := cfg.cacheGet(key); ok {
+			return b, nil
+		}
+	}
+	var buf bytes.Buffer
+	if err := e.encode(&buf, data); err != nil {
+		return nil, err
+	}
+	if key != "" {
+		if err := cfg.cachePut(key, buf.Bytes()); err != nil {
+			cfg.warnf("cache: %v", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// acceptsEncoding returns true if the request accepts the content encoding.
+func acceptsEncoding(r *http.Request, name string) bool {
+	for _, v := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(v, ";")
+		coding := strings.TrimSpace(params[0])
+		if coding != name && coding != "*" {
+			continue
+		}
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if q, err := strconv.ParseFloat(p[2:], 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compressedHandler serves the compressed copies of the outputs, read with
+// read, to the clients accepting their encodings, in the order of the
+// formats. The other requests are served by h.
+func (cfg *config) compressedHandler(h http.Handler, read func(name string) ([]byte, bool)) http.Handler {
+	if len(cfg.Compress.Formats) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if name == "" || strings.HasSuffix(r.URL.Path, "/") {
+			name = path.Join(name, "index.html")
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		if cfg.isCompressed(name) && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			for _, f := range cfg.Compress.Formats {
+				e := encodings[f]
+				if !acceptsEncoding(r, e.name) {
+					continue
+				}
+				b, ok := read(name + e.ext)
+				if !ok {
+					continue
+				}
+				ctype := mime.TypeByExtension(path.Ext(name))
+				if ctype == "" {
+					ctype = "application/octet-stream"
+				}
+				w.Header().Set("Content-Type", ctype)
+				w.Header().Set("Content-Encoding", e.name)
+				http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(b))
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// readDest reads the file name of the destination directory.
+func (cfg *config) readDest(name string) ([]byte, bool) {
+	b, err := ioutil.ReadFile(filepath.Join(cfg.Destination, filepath.FromSlash(name)))
+	return b, err == nil
+}
@@ -0,0 +1,166 @@
+package site
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestCompress(t *testing.T) {
+	page := strings.Repeat("<p>hello, world</p>\n", 100)
+	noise := make([]byte, 2048)
+	if _, err := rand.Read(noise); err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"_config.yml": {Data: []byte("compress:\n  formats: [gzip, brotli, zstd]")},
+		"_posts":      {Mode: fs.ModeDir},
+		"index.html":  {Data: []byte(page)},
+		"small.html":  {Data: []byte("<p>hi</p>")},
+		"noise.js":    {Data: noise},
+		"big.txt":     {Data: []byte(page)},
+	}
+	out := NewMemoryOutput()
+	s := New(Options{FS: fsys, Output: out, Stdout: ioutil.Discard})
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Build(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	decoders := map[string]func(r io.Reader) (io.Reader, error){
+		".gz": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		".br": func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+		".zst": func(r io.Reader) (io.Reader, error) {
+			d, err := zstd.NewReader(r)
+			return d, err
+		},
+	}
+	for ext, decode := range decoders {
+		b, ok := out.ReadFile("index.html" + ext)
+		if !ok {
+			t.Fatalf("want index.html%s but got %v", ext, out.Names())
+		}
+		r, err := decode(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != page {
+			t.Fatalf("index.html%s: want the page but got %q", ext, got)
+		}
+		for _, name := range []string{"small.html", "noise.js", "big.txt"} {
+			if _, ok := out.ReadFile(name + ext); ok {
+				t.Fatalf("want %s%s skipped", name, ext)
+			}
+		}
+	}
+
+	handler := s.cfg.compressedHandler(out, out.ReadFile)
+	tests := []struct {
+		path   string
+		accept string
+		want   string
+	}{
+		{"/", "gzip, deflate, br", "gzip"},
+		{"/index.html", "br", "br"},
+		{"/index.html", "gzip;q=0, zstd", "zstd"},
+		{"/index.html", "", ""},
+		{"/small.html", "gzip", ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.path, nil)
+		if test.accept != "" {
+			r.Header.Set("Accept-Encoding", test.accept)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if got := w.Header().Get("Content-Encoding"); got != test.want {
+			t.Errorf("%s %q: want encoding %q but got %q", test.path, test.accept, test.want, got)
+		}
+		if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/html") {
+			t.Errorf("%s %q: want text/html but got %q", test.path, test.accept, got)
+		}
+		if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("%s %q: want Vary but got %q", test.path, test.accept, got)
+		}
+	}
+
+	s = New(Options{FS: fstest.MapFS{"_config.yml": {Data: []byte("compress:\n  formats: [lzma]")}}, Output: NewMemoryOutput()})
+	if err := s.Load(); err == nil || !strings.HasPrefix(err.Error(), "compress: ") {
+		t.Fatalf("want a compress error but got %v", err)
+	}
+}
+
+func TestCompressMinSize(t *testing.T) {
+	for _, test := range []struct {
+		config string
+		want   bool
+	}{
+		{"compress:\n  formats: [gzip]", false},
+		{"compress:\n  formats: [gzip]\n  min_size: 0", true},
+	} {
+		fsys := fstest.MapFS{
+			"_config.yml": {Data: []byte(test.config)},
+			"_posts":      {Mode: fs.ModeDir},
+			"a.css":       {Data: []byte(strings.Repeat("a{}\n", 50))},
+		}
+		out := NewMemoryOutput()
+		s := New(Options{FS: fsys, Output: out, Stdout: ioutil.Discard})
+		if err := s.Load(); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Build(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := out.ReadFile("a.css.gz"); ok != test.want {
+			t.Errorf("%q: want a.css.gz %v but got %v", test.config, test.want, ok)
+		}
+	}
+}
+
+func TestCompressStale(t *testing.T) {
+	dir, cfg := makeSite("compress:\n  formats: [gzip]\n  min_size: 100", map[string]string{
+		"a.css":        strings.Repeat("a { color: red; }\n", 20),
+		"_posts/.keep": "",
+	})
+	defer os.RemoveAll(dir)
+	cfg.stdout = ioutil.Discard
+
+	gz := filepath.Join(dir, "_site", "a.css.gz")
+	if err := cfg.build(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(gz); err != nil {
+		t.Fatal(err)
+	}
+
+	// The copy of the previous build is removed with the output below
+	// min_size.
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.css"), []byte("a{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.build(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(gz); !os.IsNotExist(err) {
+		t.Fatalf("want a.css.gz removed but got %v", err)
+	}
+}
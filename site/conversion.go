@@ -0,0 +1,282 @@
+package site
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flosch/pongo2"
+)
+
+// conversion converts the files of an extension with external commands
+// instead of rendering them. Command is run by the shell and writes {{to}}
+// itself. Filters are run without a shell, read the source on stdin and write
+// the output on stdout; they are chained, after Command if it is given:
+//
+//	conversion:
+//	  js:
+//	    ext: js
+//	    timeout: 30s
+//	    filters:
+//	      - command: [esbuild, --minify, --loader=js]
+//	      - command: [./bin/banner, "{{ from }}"]
+//	        env: {BANNER: jedie}
+type conversion struct {
+	Ext     string            `yaml:"ext"`
+	Command string            `yaml:"command"`
+	Filters []filter          `yaml:"filters"`
+	Timeout string            `yaml:"timeout"`
+	Env     map[string]string `yaml:"env"`
+}
+
+// filter is a command of a conversion. The arguments may use {{ from }}, the
+// path of the source file. Timeout and Env default to the ones of the
+// conversion.
+type filter struct {
+	Command []string          `yaml:"command"`
+	Timeout string            `yaml:"timeout"`
+	Env     map[string]string `yaml:"env"`
+}
+
+// active returns true if the conversion has a command to run.
+func (c *conversion) active() bool {
+	return c != nil && c.Ext != "" && (c.Command != "" || len(c.Filters) > 0)
+}
+
+// checkConversion checks the timeouts and commands of the conversions.
+func (cfg *config) checkConversion() error {
+	for k, c := range cfg.Conversion {
+		if c == nil {
+			continue
+		}
+		if _, err := parseTimeout(c.Timeout); err != nil {
+			return fmt.Errorf("conversion: %s: %v", k, err)
+		}
+		for _, f := range c.Filters {
+			if len(f.Command) == 0 {
+				return fmt.Errorf("conversion: %s: filter command is required", k)
+			}
+			if _, err := parseTimeout(f.Timeout); err != nil {
+				return fmt.Errorf("conversion: %s: %v", k, err)
+			}
+		}
+	}
+	return nil
+}
+
+func parseTimeout(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("timeout: %v", err)
+	}
+	return d, nil
+}
+
+// conversionOf returns the conversion of the file, or nil if it is not
+// converted by commands.
+func (cfg *config) conversionOf(src string) *conversion {
+	c := cfg.Conversion[strings.TrimPrefix(filepath.Ext(src), ".")]
+	if !c.active() {
+		return nil
+	}
+	return c
+}
+
+// convert converts the file src with the commands of the conversion, and
+// writes the output to dst. The output is cached by the content of src and
+// the command lines, and reused while they are unchanged.
+func (cfg *config) convert(ctx context.Context, c *conversion, src, dst string) error {
+	var key string
+	if cfg.cacheDir() != "" {
+		var err error
+		if key, err = cfg.conversionKey(c, src, dst); err != nil {
+			return err
+		}
+		if b, ok := cfg.cacheGet(key); ok {
+			return cfg.writeOutput(dst, b)
+		}
+	}
+	data, err := cfg.runConversions(ctx, c, src, dst)
+	if err != nil {
+		return err
+	}
+	if key != "" {
+		if err := cfg.cachePut(key, data); err != nil {
+			cfg.warnf("cache: %v", err)
+		}
+	}
+	return nil
+}
+
+// runConversions runs the command and the filters of the conversion, writes
+// the output to dst and returns it.
+func (cfg *config) runConversions(ctx context.Context, c *conversion, src, dst string) ([]byte, error) {
+	if len(c.Filters) == 0 {
+		return cfg.runConversion(ctx, c, src, dst)
+	}
+
+	var data []byte
+	if c.Command != "" {
+		tmp, err := ioutil.TempDir("", "jedie")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmp)
+		to := filepath.ToSlash(filepath.Join(tmp, "to"+filepath.Ext(dst)))
+		if data, err = cfg.runConversion(ctx, c, src, to); err != nil {
+			return nil, err
+		}
+	} else {
+		b, err := cfg.readFile(src)
+		if err != nil {
+			return nil, err
+		}
+		data = b
+	}
+
+	for _, f := range c.Filters {
+		argv := make([]string, len(f.Command))
+		for i, arg := range f.Command {
+			s, err := cfg.expandCommand(arg, pongo2.Context{"from": src})
+			if err != nil {
+				return nil, fmt.Errorf("filter %s: %v", f.Command[0], err)
+			}
+			argv[i] = s
+		}
+		timeout := f.Timeout
+		if timeout == "" {
+			timeout = c.Timeout
+		}
+		d, _ := parseTimeout(timeout)
+		env := map[string]string{}
+		for k, v := range c.Env {
+			env[k] = v
+		}
+		for k, v := range f.Env {
+			env[k] = v
+		}
+		out, err := execCommand(ctx, "", argv, env, d, data)
+		if err != nil {
+			return nil, fmt.Errorf("filter %s: %v", argv[0], err)
+		}
+		data = out
+	}
+	return data, cfg.writeOutput(dst, data)
+}
+
+// runConversion runs the shell command of the conversion. The command reads
+// and writes files on the disk, so temporary files stand in for the source
+// and the destination when the site is not read from or written to the
+// disk. It returns the output.
+func (cfg *config) runConversion(ctx context.Context, c *conversion, src, dst string) ([]byte, error) {
+	from, to := src, dst
+	toDest := strings.HasPrefix(dst, cfg.Destination+"/")
+	if !cfg.onDisk || (toDest && !cfg.toDisk()) {
+		tmp, err := ioutil.TempDir("", "jedie")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmp)
+		if !cfg.onDisk {
+			b, err := cfg.readFile(src)
+			if err != nil {
+				return nil, err
+			}
+			from = filepath.ToSlash(filepath.Join(tmp, "from"+filepath.Ext(src)))
+			if err := ioutil.WriteFile(from, b, 0644); err != nil {
+				return nil, err
+			}
+		}
+		if toDest && !cfg.toDisk() {
+			to = filepath.ToSlash(filepath.Join(tmp, "to"+filepath.Ext(dst)))
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return nil, err
+	}
+
+	command, err := cfg.expandCommand(c.Command, pongo2.Context{"from": from, "to": to})
+	if err != nil {
+		return nil, err
+	}
+	log.Println("converting:", command)
+	argv := []string{"sh", "-c", command}
+	if runtime.GOOS == "windows" {
+		argv = []string{"cmd", "/c", command}
+	}
+	d, _ := parseTimeout(c.Timeout)
+	if _, err := execCommand(ctx, "", argv, c.Env, d, nil); err != nil {
+		return nil, fmt.Errorf("conversion: %v", err)
+	}
+	b, err := ioutil.ReadFile(to)
+	if err != nil {
+		return nil, err
+	}
+	if to == dst {
+		// The command wrote the output itself, but not the compressed
+		// copies.
+		return b, cfg.writeCompressed(strings.TrimPrefix(to, cfg.Destination+"/"), b)
+	}
+	return b, cfg.writeOutput(dst, b)
+}
+
+// expandCommand expands the variables in the command or argument s.
+func (cfg *config) expandCommand(s string, vars pongo2.Context) (string, error) {
+	tpl, err := cfg.templateSet().FromString("{% autoescape off %}" + s + "{% endautoescape %}")
+	if err != nil {
+		return "", err
+	}
+	return tpl.Execute(vars)
+}
+
+// execCommand runs argv in dir, or the working directory if dir is empty,
+// with stdin and returns its stdout. The command is killed after the timeout
+// if it is not zero. The error has the stderr of the command.
+func execCommand(ctx context.Context, dir string, argv []string, env map[string]string, timeout time.Duration, stdin []byte) ([]byte, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = dir
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Children of a killed shell may keep the pipes open.
+	cmd.WaitDelay = time.Second
+	if len(env) > 0 {
+		keys := make([]string, 0, len(env))
+		for k := range env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		cmd.Env = os.Environ()
+		for _, k := range keys {
+			cmd.Env = append(cmd.Env, k+"="+env[k])
+		}
+	}
+	if err := cmd.Run(); err != nil {
+		if timeout > 0 && ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %v", timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%v: %s", err, msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
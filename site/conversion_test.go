@@ -0,0 +1,161 @@
+package site
+
+import (
+	"context"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestConversion(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("conversion commands need sh")
+	}
+	tests := []struct {
+		conversion string
+		want       string
+		err        string
+	}{
+		{`command: tr a-z A-Z < "{{ from }}" > "{{ to }}"`, "HELLO", ""},
+		{"filters:\n      - command: [tr, a-z, A-Z]\n      - command: [sed, s/HELLO/bye/]", "bye", ""},
+		{"command: tr a-z A-Z < \"{{ from }}\" > \"{{ to }}\"\n    filters:\n      - command: [tr, L, l]", "HEllO", ""},
+		{"env: {BANNER: jedie}\n    filters:\n      - command: [sh, -c, 'cat; printf \" $BANNER $SUFFIX\"']\n        env: {SUFFIX: '!'}", "hello jedie !", ""},
+		{"filters:\n      - command: [sh, -c, 'printf \"%s\" \"$1\"', sh, '{{ from }}']", "/site/my notes.txt", ""},
+		{"timeout: 100ms\n    filters:\n      - command: [sleep, '5']", "", "filter sleep: timed out after 100ms"},
+		{"filters:\n      - command: [sh, -c, 'echo bad >&2; exit 3']", "", "filter sh: exit status 3: bad"},
+		{`command: echo bad >&2; exit 3`, "", "conversion: exit status 3: bad"},
+	}
+	for _, test := range tests {
+		fsys := fstest.MapFS{
+			"_config.yml":  {Data: []byte("conversion:\n  txt:\n    ext: out\n    " + test.conversion)},
+			"my notes.txt": {Data: []byte("hello")},
+			"_posts":       {Mode: fs.ModeDir},
+		}
+		out := NewMemoryOutput()
+		s := New(Options{FS: fsys, Output: out, Stdout: ioutil.Discard})
+		if err := s.Load(); err != nil {
+			t.Fatal(err)
+		}
+		err := s.Build(context.Background())
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("want error %q but got %v", test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, ok := out.ReadFile("my notes.out")
+		if !ok {
+			t.Fatalf("want my notes.out but got %v", out.Names())
+		}
+		if got := string(b); strings.TrimSpace(got) != test.want {
+			t.Fatalf("want %q but got %q", test.want, got)
+		}
+	}
+
+	s := New(Options{FS: fstest.MapFS{"_config.yml": {Data: []byte("conversion:\n  js:\n    ext: js\n    timeout: soon")}}, Output: NewMemoryOutput()})
+	if err := s.Load(); err == nil || !strings.Contains(err.Error(), "conversion: js: timeout") {
+		t.Fatalf("want a timeout error but got %v", err)
+	}
+}
+
+func TestConversionCompress(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("conversion commands need sh")
+	}
+	dir, cfg := makeSite("compress:\n  formats: [gzip]\n  min_size: 100\nconversion:\n  txt:\n    ext: html\n    command: tr a-z A-Z < \"{{ from }}\" > \"{{ to }}\"", map[string]string{
+		"a.txt":        strings.Repeat("hello, world\n", 50),
+		"_posts/.keep": "",
+	})
+	defer os.RemoveAll(dir)
+	cfg.stdout = ioutil.Discard
+
+	// The copy is written by the command on the first build, and from the
+	// cache on the next.
+	gz := filepath.Join(dir, "_site", "a.html.gz")
+	for i := 0; i < 2; i++ {
+		if err := cfg.build(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(gz); err != nil {
+			t.Fatalf("build %d: %v", i+1, err)
+		}
+		if err := os.Remove(gz); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestConversionCache(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("conversion commands need sh")
+	}
+	tmp, err := ioutil.TempDir("", "jedie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	count := filepath.ToSlash(filepath.Join(tmp, "count"))
+
+	dir, cfg := makeSite("conversion:\n  txt:\n    ext: out\n    filters:\n      - command: [sh, -c, 'echo x >> \""+count+"\"; tr a-z A-Z']", map[string]string{
+		"a.txt":        "hello",
+		"_posts/.keep": "",
+	})
+	defer os.RemoveAll(dir)
+	cfg.stdout = ioutil.Discard
+	s := &Site{cfg: cfg, hooks: map[string][]Hook{}}
+
+	tests := []struct {
+		content string
+		want    string
+		runs    int
+		entries int
+	}{
+		{"", "HELLO", 1, 1},
+		{"", "HELLO", 1, 1},
+		{"bye", "BYE", 2, 2},
+		{"hello", "HELLO", 2, 2},
+	}
+	for _, test := range tests {
+		if test.content != "" {
+			if err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte(test.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := cfg.build(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, "_site", "a.out"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != test.want {
+			t.Fatalf("want %q but got %q", test.want, string(b))
+		}
+		b, _ = ioutil.ReadFile(count)
+		if runs := strings.Count(string(b), "x"); runs != test.runs {
+			t.Fatalf("want the filter run %d times but got %d", test.runs, runs)
+		}
+		stats, err := s.CacheStats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Entries != test.entries {
+			t.Fatalf("want %d entries but got %d", test.entries, stats.Entries)
+		}
+	}
+
+	if err := s.ClearCache(); err != nil {
+		t.Fatal(err)
+	}
+	if stats, err := s.CacheStats(); err != nil || stats.Entries != 0 {
+		t.Fatalf("want no entries but got %v, %v", stats, err)
+	}
+}
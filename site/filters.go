@@ -0,0 +1,522 @@
+package site
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/flosch/pongo2"
+	"github.com/osteele/liquid"
+	"github.com/osteele/liquid/expressions"
+	"github.com/russross/blackfriday/v2"
+)
+
+// The filters of Jekyll. They are plain functions registered to both of
+// pongo2 and Liquid.
+
+func relativeURL(cfg *config, s string) string {
+	if u, err := url.Parse(s); err == nil && u.IsAbs() {
+		return s
+	}
+	base := cfg.Baseurl
+	if u, err := url.Parse(base); err == nil {
+		base = u.Path
+	}
+	return urlJoin(base, "/"+s)
+}
+
+func absoluteURL(cfg *config, s string) string {
+	if u, err := url.Parse(s); err == nil && u.IsAbs() {
+		return s
+	}
+	return urlJoin(cfg.Baseurl, "/"+s)
+}
+
+var slugifyModes = map[string]*regexp.Regexp{
+	"raw":     regexp.MustCompile(`\s+`),
+	"default": regexp.MustCompile(`[^\p{M}\p{L}\p{Nd}]+`),
+	"pretty":  regexp.MustCompile(`[^\p{M}\p{L}\p{Nd}._~!$&'()+,;=@]+`),
+	"ascii":   regexp.MustCompile(`[^a-zA-Z0-9]+`),
+}
+
+func slugify(s string) string {
+	return slugifyMode(s, "default")
+}
+
+// slugifyMode is slugify with the modes of Jekyll: none, raw, default,
+// pretty and ascii.
+func slugifyMode(s, mode string) string {
+	if mode == "none" {
+		return s
+	}
+	re, ok := slugifyModes[mode]
+	if !ok {
+		re = slugifyModes["default"]
+	}
+	return strings.ToLower(strings.Trim(re.ReplaceAllString(s, "-"), "-"))
+}
+
+func jsonify(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func markdownify(s string) string {
+	renderer := blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{})
+	return string(blackfriday.Run([]byte(s), blackfriday.WithExtensions(extensions), blackfriday.WithRenderer(renderer)))
+}
+
+// toSlice returns the elements of the array or slice v.
+func toSlice(v interface{}) []interface{} {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Slice:
+		items := make([]interface{}, rv.Len())
+		for i := range items {
+			items[i] = rv.Index(i).Interface()
+		}
+		return items
+	}
+	return nil
+}
+
+// property returns the value of the dotted key in the map v.
+func property(v interface{}, key string) interface{} {
+	for _, name := range strings.Split(key, ".") {
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		e := rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()))
+		if !e.IsValid() {
+			return nil
+		}
+		v = e.Interface()
+	}
+	return v
+}
+
+// matches returns true if v equals value, or contains it when v is an array.
+func matches(v, value interface{}) bool {
+	if items := toSlice(v); items != nil {
+		for _, item := range items {
+			if fmt.Sprint(item) == fmt.Sprint(value) {
+				return true
+			}
+		}
+		return false
+	}
+	return v != nil && fmt.Sprint(v) == fmt.Sprint(value)
+}
+
+func where(v interface{}, key string, value interface{}) []interface{} {
+	result := []interface{}{}
+	for _, item := range toSlice(v) {
+		if matches(property(item, key), value) {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func groupBy(v interface{}, key string) []interface{} {
+	result := []interface{}{}
+	groups := map[string]pongo2.Context{}
+	for _, item := range toSlice(v) {
+		name := ""
+		if p := property(item, key); p != nil {
+			name = fmt.Sprint(p)
+		}
+		group, ok := groups[name]
+		if !ok {
+			group = pongo2.Context{"name": name, "items": []interface{}{}, "size": 0}
+			groups[name] = group
+			result = append(result, group)
+		}
+		group["items"] = append(group["items"].([]interface{}), item)
+		group["size"] = group["size"].(int) + 1
+	}
+	return result
+}
+
+// compare compares numbers, dates and strings. nil is greater than
+// anything else.
+func compare(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			switch {
+			case ta.Before(tb):
+				return -1
+			case ta.After(tb):
+				return 1
+			}
+			return 0
+		}
+	}
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// sortBy sorts the array by the property key, or by the elements themselves
+// if key is empty.
+func sortBy(v interface{}, key string) []interface{} {
+	items := toSlice(v)
+	sort.SliceStable(items, func(i, j int) bool {
+		if key == "" {
+			return compare(items[i], items[j]) < 0
+		}
+		return compare(property(items[i], key), property(items[j], key)) < 0
+	})
+	return items
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// numberOfWords counts the words separated by spaces. Every CJK character is
+// counted as a word.
+func numberOfWords(s string) int {
+	n := 0
+	for _, word := range strings.Fields(s) {
+		inWord := false
+		for _, r := range word {
+			if isCJK(r) {
+				n++
+				inWord = false
+			} else if !inWord {
+				n++
+				inWord = true
+			}
+		}
+	}
+	return n
+}
+
+func cgiEscape(s string) string {
+	return url.QueryEscape(s)
+}
+
+// uriEscape percent-encodes s except for the unreserved and reserved
+// characters of URIs.
+func uriEscape(s string) string {
+	const safe = "-._~:/?#[]@!$&'()*+,;=%"
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if c < 0x80 && (c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte(safe, c) >= 0) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func dateToXMLSchema(date time.Time) string {
+	return date.Format(time.RFC3339)
+}
+
+func dateToLongString(date time.Time, ordinal bool) string {
+	if !ordinal {
+		return date.Format("02 January 2006")
+	}
+	day := date.Day()
+	suffix := "th"
+	if day/10 != 1 {
+		switch day % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return fmt.Sprintf("%d%s %s", day, suffix, date.Format("January 2006"))
+}
+
+func arrayToSentenceString(v interface{}, connector string) string {
+	if connector == "" {
+		connector = "and"
+	}
+	var words []string
+	for _, item := range toSlice(v) {
+		words = append(words, fmt.Sprint(item))
+	}
+	switch len(words) {
+	case 0:
+		return ""
+	case 1:
+		return words[0]
+	case 2:
+		return words[0] + " " + connector + " " + words[1]
+	}
+	return strings.Join(words[:len(words)-1], ", ") + ", " + connector + " " + words[len(words)-1]
+}
+
+// smartify replaces straight quotes, dashes and ellipses in the text with
+// their typographic forms. Text in HTML tags is kept as is.
+func smartify(s string) string {
+	var b strings.Builder
+	rs := []rune(s)
+	inTag := false
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		if inTag {
+			b.WriteRune(r)
+			inTag = r != '>'
+			continue
+		}
+		opening := i == 0 || unicode.IsSpace(rs[i-1]) || strings.ContainsRune("([{-—>", rs[i-1])
+		switch {
+		case r == '<':
+			inTag = true
+			b.WriteRune(r)
+		case r == '"' && opening:
+			b.WriteRune('“')
+		case r == '"':
+			b.WriteRune('”')
+		case r == '\'' && opening:
+			b.WriteRune('‘')
+		case r == '\'':
+			b.WriteRune('’')
+		case r == '-' && i+2 < len(rs) && rs[i+1] == '-' && rs[i+2] == '-':
+			b.WriteRune('—')
+			i += 2
+		case r == '-' && i+1 < len(rs) && rs[i+1] == '-':
+			b.WriteRune('–')
+			i++
+		case r == '.' && i+2 < len(rs) && rs[i+1] == '.' && rs[i+2] == '.':
+			b.WriteRune('…')
+			i += 2
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func normalizeWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func setFilter(name string, fn pongo2.FilterFunction) {
+	if pongo2.FilterExists(name) {
+		pongo2.ReplaceFilter(name, fn)
+	} else {
+		pongo2.RegisterFilter(name, fn)
+	}
+}
+
+func filterError(name string, err error) *pongo2.Error {
+	return &pongo2.Error{Sender: "filter:" + name, OrigError: err}
+}
+
+func toDateValue(name string, in *pongo2.Value) (time.Time, *pongo2.Error) {
+	date, ok := in.Interface().(time.Time)
+	if !ok {
+		return date, filterError(name, fmt.Errorf("Date must be of type time.Time not %T ('%v')", in.Interface(), in))
+	}
+	return date, nil
+}
+
+// whereExp evaluates the expression of where_exp, which is given as
+// "item, expression", for every element of the array. The expression also
+// sees the variables of the template being rendered, such as site and page;
+// pongo2 gives the filters no context, so the variables of the loops in the
+// same template are not seen.
+func whereExp(cfg *config, v interface{}, exp string) ([]interface{}, error) {
+	i := strings.Index(exp, ",")
+	if i < 0 {
+		return nil, fmt.Errorf("where_exp must be given as \"item, expression\": %q", exp)
+	}
+	name := strings.TrimSpace(exp[:i])
+	tpl, err := cfg.templateSet().FromString("{% if " + strings.TrimSpace(exp[i+1:]) + " %}1{% endif %}")
+	if err != nil {
+		return nil, err
+	}
+	vars := pongo2.Context{}
+	if n := len(cfg.renderVars); n > 0 {
+		vars.Update(cfg.renderVars[n-1])
+	}
+	result := []interface{}{}
+	for _, item := range toSlice(v) {
+		vars[name] = item
+		s, err := tpl.Execute(vars)
+		if err != nil {
+			return nil, err
+		}
+		if s == "1" {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+// registerJekyllFilters registers the filters of Jekyll to pongo2.
+func registerJekyllFilters(cfg *config) {
+	setFilter("relative_url", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsValue(relativeURL(cfg, in.String())), nil
+	})
+	setFilter("absolute_url", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsValue(absoluteURL(cfg, in.String())), nil
+	})
+	setFilter("slugify", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsValue(slugifyMode(in.String(), param.String())), nil
+	})
+	setFilter("jsonify", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		s, err := jsonify(in.Interface())
+		if err != nil {
+			return nil, filterError("jsonify", err)
+		}
+		return pongo2.AsSafeValue(s), nil
+	})
+	setFilter("markdownify", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsSafeValue(markdownify(in.String())), nil
+	})
+	setFilter("where", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		kv := strings.SplitN(param.String(), "=", 2)
+		if len(kv) != 2 {
+			return nil, filterError("where", fmt.Errorf("where must be given as \"key=value\": %q", param.String()))
+		}
+		return pongo2.AsValue(where(in.Interface(), strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))), nil
+	})
+	setFilter("where_exp", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		result, err := whereExp(cfg, in.Interface(), param.String())
+		if err != nil {
+			return nil, filterError("where_exp", err)
+		}
+		return pongo2.AsValue(result), nil
+	})
+	setFilter("group_by", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsValue(groupBy(in.Interface(), param.String())), nil
+	})
+	setFilter("sort", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		key := ""
+		if !param.IsNil() {
+			key = param.String()
+		}
+		return pongo2.AsValue(sortBy(in.Interface(), key)), nil
+	})
+	setFilter("number_of_words", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsValue(numberOfWords(in.String())), nil
+	})
+	setFilter("cgi_escape", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsValue(cgiEscape(in.String())), nil
+	})
+	setFilter("uri_escape", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsValue(uriEscape(in.String())), nil
+	})
+	setFilter("date_to_xmlschema", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		date, err := toDateValue("date_to_xmlschema", in)
+		if err != nil {
+			return nil, err
+		}
+		return pongo2.AsValue(dateToXMLSchema(date)), nil
+	})
+	setFilter("date_to_long_string", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		date, err := toDateValue("date_to_long_string", in)
+		if err != nil {
+			return nil, err
+		}
+		return pongo2.AsValue(dateToLongString(date, param.String() == "ordinal")), nil
+	})
+	setFilter("array_to_sentence_string", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		connector := ""
+		if !param.IsNil() {
+			connector = param.String()
+		}
+		return pongo2.AsValue(arrayToSentenceString(in.Interface(), connector)), nil
+	})
+	setFilter("smartify", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsValue(smartify(in.String())), nil
+	})
+	setFilter("normalize_whitespace", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsValue(normalizeWhitespace(in.String())), nil
+	})
+}
+
+// registerLiquidFilters registers the filters of Jekyll which Liquid does
+// not have.
+func registerLiquidFilters(cfg *config, e *liquid.Engine) {
+	e.RegisterFilter("relative_url", func(s string) string {
+		return relativeURL(cfg, s)
+	})
+	e.RegisterFilter("absolute_url", func(s string) string {
+		return absoluteURL(cfg, s)
+	})
+	e.RegisterFilter("slugify", func(s string, mode func(string) string) string {
+		return slugifyMode(s, mode("default"))
+	})
+	e.RegisterFilter("jsonify", jsonify)
+	e.RegisterFilter("markdownify", markdownify)
+	e.RegisterFilter("where", where)
+	// Liquid evaluates the expression in the context of the filter, as
+	// where_exp: "item", "expression" of Jekyll.
+	e.RegisterFilter("where_exp", func(v interface{}, name string, exp expressions.Closure) ([]interface{}, error) {
+		result := []interface{}{}
+		for _, item := range toSlice(v) {
+			ok, err := exp.Bind(name, item).Evaluate()
+			if err != nil {
+				return nil, err
+			}
+			if ok != nil && ok != false {
+				result = append(result, item)
+			}
+		}
+		return result, nil
+	})
+	e.RegisterFilter("group_by", groupBy)
+	e.RegisterFilter("number_of_words", numberOfWords)
+	e.RegisterFilter("cgi_escape", cgiEscape)
+	e.RegisterFilter("uri_escape", uriEscape)
+	e.RegisterFilter("date_to_xmlschema", dateToXMLSchema)
+	e.RegisterFilter("date_to_long_string", func(date time.Time, mode func(string) string) string {
+		return dateToLongString(date, mode("") == "ordinal")
+	})
+	e.RegisterFilter("array_to_sentence_string", func(v interface{}, connector func(string) string) string {
+		return arrayToSentenceString(v, connector("and"))
+	})
+	e.RegisterFilter("smartify", smartify)
+	e.RegisterFilter("normalize_whitespace", normalizeWhitespace)
+}
@@ -0,0 +1,147 @@
+package site
+
+import (
+	"testing"
+	"time"
+
+	"github.com/flosch/pongo2"
+)
+
+func TestJekyllFilters(t *testing.T) {
+	cfg := &config{Baseurl: "http://example.com/blog"}
+	pongoSetup(cfg)
+
+	date := time.Date(2008, 11, 7, 13, 7, 54, 0, time.FixedZone("", -8*60*60))
+	posts := []pongo2.Context{
+		{"title": "Go", "category": "lang", "tags": []interface{}{"go", "web"}, "n": 3},
+		{"title": "Vim", "category": "editor", "tags": []interface{}{"vim"}, "n": 1},
+		{"title": "Rust", "category": "lang", "n": 2},
+	}
+	vars := pongo2.Context{
+		"date":   date,
+		"posts":  posts,
+		"words":  []interface{}{"foo", "bar", "baz"},
+		"nums":   []interface{}{3, 10, 2},
+		"obj":    pongo2.Context{"a": 1},
+		"spaces": "  foo\n\tbar  baz ",
+	}
+
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{`{{ "/feed.xml"|relative_url }}`, "/blog/feed.xml"},
+		{`{{ "feed.xml"|relative_url }}`, "/blog/feed.xml"},
+		{`{{ "/feed.xml"|absolute_url }}`, "http://example.com/blog/feed.xml"},
+		{`{{ "http://golang.org/"|absolute_url }}`, "http://golang.org/"},
+		{`{{ "Hello, World!"|slugify }}`, "hello-world"},
+		{`{{ "こんにちわ 世界"|slugify }}`, "こんにちわ-世界"},
+		{`{{ "The _config.yml file"|slugify:"pretty" }}`, "the-_config.yml-file"},
+		{`{{ "The _config.yml file"|slugify:"raw" }}`, "the-_config.yml-file"},
+		{`{{ "日本語 file"|slugify:"ascii" }}`, "file"},
+		{`{{ "Hello World"|slugify:"none" }}`, "Hello World"},
+		{`{{ obj|jsonify }}`, `{"a":1}`},
+		{`{{ words|jsonify }}`, `["foo","bar","baz"]`},
+		{`{{ "*dude*"|markdownify }}`, "<p><em>dude</em></p>\n"},
+		{`{% for p in posts|where:"category=lang" %}{{ p.title }} {% endfor %}`, "Go Rust "},
+		{`{% for p in posts|where:"tags=vim" %}{{ p.title }} {% endfor %}`, "Vim "},
+		{`{% for p in posts|where_exp:"post, post.n > 1" %}{{ p.title }} {% endfor %}`, "Go Rust "},
+		{`{% for g in posts|group_by:"category" %}{{ g.name }}:{{ g.size }}{% for p in g.items %} {{ p.title }}{% endfor %};{% endfor %}`, "lang:2 Go Rust;editor:1 Vim;"},
+		{`{% for p in posts|sort:"n" %}{{ p.title }} {% endfor %}`, "Vim Rust Go "},
+		{`{% for p in posts|sort:"title" %}{{ p.title }} {% endfor %}`, "Go Rust Vim "},
+		{`{% for n in nums|sort %}{{ n }} {% endfor %}`, "2 3 10 "},
+		{`{{ "foo bar  baz"|number_of_words }}`, "3"},
+		{`{{ "Go言語 is 楽しい"|number_of_words }}`, "7"},
+		{`{{ "foo,bar;baz?"|cgi_escape }}`, "foo%2Cbar%3Bbaz%3F"},
+		{`{{ "foo, bar \\baz?"|uri_escape }}`, "foo,%20bar%20%5Cbaz?"},
+		{`{{ "/日本"|uri_escape }}`, "/%E6%97%A5%E6%9C%AC"},
+		{`{{ date|date_to_xmlschema }}`, "2008-11-07T13:07:54-08:00"},
+		{`{{ date|date_to_long_string }}`, "07 November 2008"},
+		{`{{ date|date_to_long_string:"ordinal" }}`, "7th November 2008"},
+		{`{{ words|array_to_sentence_string }}`, "foo, bar, and baz"},
+		{`{{ words|array_to_sentence_string:"or" }}`, "foo, bar, or baz"},
+		{`{{ words|slice:":2"|array_to_sentence_string }}`, "foo and bar"},
+		{`{{ "\"Jedie\" isn't -- Jekyll..."|smartify }}`, "“Jedie” isn’t – Jekyll…"},
+		{`{{ "<a href=\"x\">'a' --- b</a>"|smartify }}`, "<a href=\"x\">‘a’ — b</a>"},
+		{`{{ spaces|normalize_whitespace }}`, "foo bar baz"},
+	}
+
+	for _, test := range tests {
+		tpl, err := pongo2.FromString(test.in)
+		if err != nil {
+			t.Errorf("%s: %v", test.in, err)
+			continue
+		}
+		actual, err := tpl.Execute(vars)
+		if err != nil {
+			t.Errorf("%s: %v", test.in, err)
+			continue
+		}
+		if actual != test.out {
+			t.Errorf("%s: expected %q actual %q", test.in, test.out, actual)
+		}
+	}
+}
+
+func TestLiquidJekyllFilters(t *testing.T) {
+	cfg := &config{Baseurl: "http://example.com/blog"}
+	e := newLiquidEngine(cfg)
+
+	vars := pongo2.Context{
+		"posts": []interface{}{
+			map[string]interface{}{"title": "Go", "category": "lang"},
+			map[string]interface{}{"title": "Vim", "category": "editor"},
+		},
+		"words": []interface{}{"foo", "bar"},
+		"cats":  []interface{}{"lang", "editor"},
+		"site":  map[string]interface{}{"skip": "Go"},
+	}
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{`{{ "/feed.xml" | relative_url }}`, "/blog/feed.xml"},
+		{`{{ "Hello, World!" | slugify }}`, "hello-world"},
+		{`{% assign ps = posts | where: "category", "lang" %}{% for p in ps %}{{ p.title }}{% endfor %}`, "Go"},
+		{`{% assign gs = posts | group_by: "category" %}{% for g in gs %}{{ g.name }}{% endfor %}`, "langeditor"},
+		{`{{ words | array_to_sentence_string }}`, "foo and bar"},
+		{`{{ "Go言語" | number_of_words }}`, "3"},
+		{`{% assign ps = posts | where_exp: "p", "p.category == 'lang'" %}{% for p in ps %}{{ p.title }}{% endfor %}`, "Go"},
+		{`{% for c in cats %}{% assign ps = posts | where_exp: "p", "p.category == c" %}{% for p in ps %}{{ p.title }}{% endfor %};{% endfor %}`, "Go;Vim;"},
+		{`{% assign ps = posts | where_exp: "p", "p.title != site.skip" %}{% for p in ps %}{{ p.title }}{% endfor %}`, "Vim"},
+	}
+
+	for _, test := range tests {
+		actual, err := e.renderString("test", test.in, vars)
+		if err != nil {
+			t.Errorf("%s: %v", test.in, err)
+			continue
+		}
+		if actual != test.out {
+			t.Errorf("%s: expected %q actual %q", test.in, test.out, actual)
+		}
+	}
+}
+
+func TestWhereExpContext(t *testing.T) {
+	cfg := &config{}
+	pongoSetup(cfg)
+	e := &pongoEngine{cfg: cfg}
+	vars := pongo2.Context{
+		"site": pongo2.Context{"time": 2},
+		"page": pongo2.Context{"title": "Vim"},
+		"posts": []pongo2.Context{
+			{"title": "Go", "n": 3},
+			{"title": "Vim", "n": 1},
+			{"title": "Rust", "n": 2},
+		},
+	}
+	in := `{% for p in posts|where_exp:"post, post.n < site.time or post.title == page.title" %}{{ p.title }} {% endfor %}`
+	actual, err := e.renderString("test", in, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Vim "; actual != want {
+		t.Fatalf("expected %q actual %q", want, actual)
+	}
+}
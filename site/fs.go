@@ -0,0 +1,100 @@
+package site
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// fsBase is the directory of a site read from an fs.FS given in Options. The
+// paths of the site are absolute in the builder, so the root of the fs.FS is
+// mapped to it.
+const fsBase = "/site"
+
+// initFS sets the file system where the site is read from. Without an
+// fs.FS, the site is read from the disk and relative paths are relative to
+// the working directory.
+func (cfg *config) initFS(fsys fs.FS) error {
+	if fsys != nil {
+		cfg.fsys = fsys
+		cfg.fsRoot = fsBase
+		cfg.base = fsBase
+		return nil
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	cfg.base = filepath.ToSlash(cwd)
+	cfg.fsRoot = filepath.ToSlash(filepath.VolumeName(cwd))
+	cfg.fsys = os.DirFS(cfg.fsRoot + "/")
+	cfg.onDisk = true
+	return nil
+}
+
+// setupFS reads the site from the disk if no file system is set yet.
+func (cfg *config) setupFS() {
+	if cfg.fsys == nil {
+		if err := cfg.initFS(nil); err != nil {
+			cfg.fsys = os.DirFS("/")
+		}
+	}
+}
+
+// abs returns the absolute path of p, which is relative to the base
+// directory of the site.
+func (cfg *config) abs(p string) string {
+	cfg.setupFS()
+	p = filepath.ToSlash(p)
+	if filepath.IsAbs(p) || strings.HasPrefix(p, "/") {
+		return path.Clean(p)
+	}
+	return path.Join(cfg.base, p)
+}
+
+// fsName returns the name of the absolute path p in the file system.
+func (cfg *config) fsName(p string) string {
+	cfg.setupFS()
+	p = filepath.ToSlash(p)
+	name := strings.TrimPrefix(p, cfg.fsRoot)
+	if name != "" && !strings.HasPrefix(name, "/") {
+		// Not in the file system; fs.FS refuses the name.
+		return p
+	}
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (cfg *config) readFile(p string) ([]byte, error) {
+	return fs.ReadFile(cfg.fsys, cfg.fsName(p))
+}
+
+func (cfg *config) stat(p string) (fs.FileInfo, error) {
+	return fs.Stat(cfg.fsys, cfg.fsName(p))
+}
+
+func (cfg *config) readDir(p string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(cfg.fsys, cfg.fsName(p))
+}
+
+// fsPath returns the absolute path of the name in the file system.
+func (cfg *config) fsPath(name string) string {
+	if name == "." {
+		return cfg.fsRoot + "/"
+	}
+	return cfg.fsRoot + "/" + name
+}
+
+// walk walks the directory root like filepath.WalkDir, with the absolute
+// paths of the files.
+func (cfg *config) walk(root string, fn fs.WalkDirFunc) error {
+	root = cfg.fsName(cfg.abs(root))
+	return fs.WalkDir(cfg.fsys, root, func(name string, d fs.DirEntry, err error) error {
+		return fn(path.Clean(cfg.fsPath(name)), d, err)
+	})
+}
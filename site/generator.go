@@ -0,0 +1,253 @@
+package site
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/flosch/pongo2"
+)
+
+// generator is an external command which generates pages, site variables
+// and files from the site. It is run in the source directory with the
+// arguments as is, without a shell, and killed after the timeout if given:
+//
+//	generators:
+//	  - name: archive
+//	    command: [./bin/archive, --by-year]
+//	    timeout: 30s
+type generator struct {
+	Name    string   `yaml:"name"`
+	Command []string `yaml:"command"`
+	Timeout string   `yaml:"timeout"`
+}
+
+// generatorInput is the site sent to a generator on stdin.
+type generatorInput struct {
+	Config map[string]interface{}   `json:"config"`
+	Site   map[string]interface{}   `json:"site"`
+	Pages  []map[string]interface{} `json:"pages"`
+	Posts  []map[string]interface{} `json:"posts"`
+	Data   map[string]interface{}   `json:"data"`
+}
+
+// generatorOutput is read from stdout of a generator. Pages have the path
+// relative to the source directory and the content, and the other keys are
+// front matter. Files are written to the destination as is. Site is merged
+// into the site variables.
+type generatorOutput struct {
+	Pages []map[string]interface{} `json:"pages"`
+	Files []struct {
+		Path    string `json:"path"`
+		Content string `json:"content"`
+	} `json:"files"`
+	Site map[string]interface{} `json:"site"`
+}
+
+// virtualPage is a page which has no source file.
+type virtualPage struct {
+	vars    pongo2.Context
+	content string
+}
+
+// generatedFile is a file from a generator, written to the destination as
+// is.
+type generatedFile struct {
+	to      string
+	from    string
+	content string
+}
+
+// checkGenerators checks the timeouts of the generators.
+func (cfg *config) checkGenerators() error {
+	for _, g := range cfg.Generators {
+		if _, err := parseTimeout(g.Timeout); err != nil {
+			name := g.Name
+			if name == "" && len(g.Command) > 0 {
+				name = g.Command[0]
+			}
+			return fmt.Errorf("generator %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// jsonValue converts maps decoded from YAML, which have interface{} keys, so
+// that v can be encoded to JSON.
+func jsonValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, v := range t {
+			m[fmt.Sprint(k)] = jsonValue(v)
+		}
+		return m
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for k, v := range t {
+			m[k] = jsonValue(v)
+		}
+		return m
+	case pongo2.Context:
+		return jsonValue(map[string]interface{}(t))
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, v := range t {
+			s[i] = jsonValue(v)
+		}
+		return s
+	case []pongo2.Context:
+		s := make([]interface{}, len(t))
+		for i, v := range t {
+			s[i] = jsonValue(v)
+		}
+		return s
+	}
+	return v
+}
+
+// jsonObject converts the map v like jsonValue, or returns an empty map if v
+// is not a map.
+func jsonObject(v interface{}) map[string]interface{} {
+	if m, ok := jsonValue(v).(map[string]interface{}); ok {
+		return m
+	}
+	return map[string]interface{}{}
+}
+
+// fromJSON converts integral numbers decoded from JSON to int, so that
+// templates print them as integers.
+func fromJSON(v interface{}) interface{} {
+	switch t := v.(type) {
+	case float64:
+		if t == float64(int(t)) {
+			return int(t)
+		}
+	case map[string]interface{}:
+		for k, v := range t {
+			t[k] = fromJSON(v)
+		}
+	case []interface{}:
+		for i, v := range t {
+			t[i] = fromJSON(v)
+		}
+	}
+	return v
+}
+
+// generatorPath checks that the path from a generator is relative and stays
+// in dir, and returns it joined to dir.
+func generatorPath(dir, p string) (string, error) {
+	clean := path.Clean(filepath.ToSlash(p))
+	if p == "" || filepath.IsAbs(p) || path.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("invalid path %q", p)
+	}
+	return dir + "/" + clean, nil
+}
+
+// runGenerators runs the generators in order. The pages from a generator are
+// appended to pages, and seen by the following generators.
+func (cfg *config) runGenerators(ctx context.Context, pages, posts []pongo2.Context) ([]pongo2.Context, error) {
+	site := cfg.vars["site"].(pongo2.Context)
+	for _, g := range cfg.Generators {
+		name := g.Name
+		if name == "" && len(g.Command) > 0 {
+			name = g.Command[0]
+		}
+		if len(g.Command) == 0 {
+			return nil, fmt.Errorf("generator %s: command is required", name)
+		}
+
+		siteVars := map[string]interface{}{}
+		for k, v := range site {
+			switch k {
+			case "pages", "posts", "categories", "data":
+			default:
+				siteVars[k] = jsonValue(v)
+			}
+		}
+		input := generatorInput{
+			Config: jsonObject(cfg.settings),
+			Site:   siteVars,
+			Pages:  []map[string]interface{}{},
+			Posts:  []map[string]interface{}{},
+			Data:   jsonObject(site["data"]),
+		}
+		for _, page := range pages {
+			input.Pages = append(input.Pages, jsonObject(page))
+		}
+		for _, post := range posts {
+			input.Posts = append(input.Posts, jsonObject(post))
+		}
+		b, err := json.Marshal(input)
+		if err != nil {
+			return nil, fmt.Errorf("generator %s: %v", name, err)
+		}
+
+		// Sites not on the disk have no directory to run in.
+		var dir string
+		if cfg.onDisk {
+			dir = cfg.Source
+		}
+		d, _ := parseTimeout(g.Timeout)
+		stdout, err := execCommand(ctx, dir, g.Command, nil, d, b)
+		if err != nil {
+			return nil, fmt.Errorf("generator %s: %v", name, err)
+		}
+		var output generatorOutput
+		if err := json.Unmarshal(stdout, &output); err != nil {
+			return nil, fmt.Errorf("generator %s: invalid output: %v", name, err)
+		}
+
+		for k, v := range output.Site {
+			site[k] = fromJSON(v)
+		}
+		for _, p := range output.Pages {
+			from, err := generatorPath(cfg.Source, str(p["path"]))
+			if err != nil {
+				return nil, fmt.Errorf("generator %s: page: %v", name, err)
+			}
+			vars := pongo2.Context{}
+			for k, v := range p {
+				switch k {
+				case "path", "content":
+				default:
+					vars[k] = fromJSON(v)
+				}
+			}
+			cfg.virtual[from] = virtualPage{vars: vars, content: str(p["content"])}
+
+			page := pongo2.Context{}
+			page.Update(vars)
+			page["path"] = from
+			page["url"] = cfg.toPageURL(from, vars)
+			page["date"], err = cfg.toDate(from, vars)
+			if err != nil {
+				cfg.warnf("%v", err)
+			}
+			pages = append(pages, page)
+		}
+		for _, f := range output.Files {
+			to, err := generatorPath(cfg.Destination, f.Path)
+			if err != nil {
+				return nil, fmt.Errorf("generator %s: file: %v", name, err)
+			}
+			cfg.generated = append(cfg.generated, generatedFile{to: to, from: "(generator " + name + ")", content: f.Content})
+		}
+	}
+	return pages, nil
+}
+
+// writeGenerated writes the files from the generators.
+func (cfg *config) writeGenerated(ctx context.Context) error {
+	for _, f := range cfg.generated {
+		fmt.Fprintln(cfg.out(), f.from, "=>", f.to)
+		if err := cfg.writeFile(ctx, f.from, f.to, []byte(f.content)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
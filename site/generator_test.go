@@ -0,0 +1,79 @@
+package site
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const generatorScript = `#!/bin/sh
+input=$(cat)
+case "$input" in
+*'"config":{"generators"'*'"name":"jedie"'*'"title":"Hello"'*) ;;
+*) echo "unexpected input: $input" >&2; exit 1;;
+esac
+cat <<'JSON'
+{
+  "pages": [{"path": "archive/index.html", "layout": "default", "title": "Archive", "content": "{% for post in site.posts %}{{ post.title }}{% endfor %} of {{ site.archive_count }}"}],
+  "site": {"archive_count": 1},
+  "files": [{"path": "api/posts.json", "content": "[\"Hello\"]"}]
+}
+JSON
+`
+
+func TestGenerators(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("generator scripts need sh")
+	}
+	tests := []struct {
+		script string
+		err    string
+	}{
+		{generatorScript, ""},
+		{"#!/bin/sh\necho boom >&2\nexit 1\n", "generator gen: exit status 1: boom"},
+		{"#!/bin/sh\necho '{\"files\": [{\"path\": \"../escape.txt\"}]}'\n", `generator gen: file: invalid path "../escape.txt"`},
+		{"#!/bin/sh\necho nothing\n", "generator gen: invalid output"},
+		{"#!/bin/sh\nsleep 5\n", "generator gen: timed out after 100ms"},
+	}
+	for _, test := range tests {
+		dir, cfg := makeSite("name: jedie\ngenerators:\n  - name: gen\n    command: [sh, gen.sh]\n    timeout: 100ms", map[string]string{
+			"gen.sh":                     test.script,
+			"_layouts/default.html":      "<h1>{{ page.title }}</h1>{{ content }}",
+			"_posts/2013-11-23-hello.md": "---\ntitle: Hello\n---\nhello",
+		})
+		defer os.RemoveAll(dir)
+
+		err := cfg.build(context.Background())
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("want error %q but got %v", test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for file, want := range map[string]string{
+			"archive/index.html": "<h1>Archive</h1>Hello of 1",
+			"api/posts.json":     `["Hello"]`,
+		} {
+			b, err := ioutil.ReadFile(filepath.Join(dir, "_site", file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(string(b)); got != want {
+				t.Errorf("%s: want %q but got %q", file, want, got)
+			}
+		}
+	}
+	s := New(Options{FS: fstest.MapFS{"_config.yml": {Data: []byte("generators:\n  - name: gen\n    command: [gen]\n    timeout: soon")}}, Output: NewMemoryOutput()})
+	if err := s.Load(); err == nil || !strings.Contains(err.Error(), "generator gen: timeout") {
+		t.Fatalf("want a timeout error but got %v", err)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package site
 
 import (
 	"bytes"
@@ -8,7 +8,6 @@ import (
 	"net/url"
 	"os"
 	"path"
-	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
@@ -32,36 +31,106 @@ func str(s interface{}) string {
 	return ""
 }
 
-func include(cfg *config, vars pongo2.Context) func(*string) (string, error) {
-	return func(loc *string) (string, error) {
-		inc := filepath.ToSlash(filepath.Join(cfg.Includes, *loc))
-		tpl, err := pongo2.FromFile(inc)
-		if err != nil {
-			return "", fmt.Errorf("%s: %v", inc, err)
+// dateLayouts are the layouts accepted for dates in front matter. Layouts
+// without a zone are interpreted in the site timezone.
+var dateLayouts = []string{
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 -07:00",
+	"2006-01-02 15:04:05 -07",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04 -0700",
+	"2006-01-02 15:04 -07:00",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// yamlShortZone matches the one digit zone offset allowed in YAML timestamps.
+var yamlShortZone = regexp.MustCompile(`\s([-+])(\d)$`)
+
+func parseDate(v interface{}, loc *time.Location) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t.In(loc), nil
+	case *time.Time:
+		return t.In(loc), nil
+	}
+	s := strings.TrimSpace(fmt.Sprint(v))
+	if len(s) > 10 && (s[10] == 't' || s[10] == '\t') {
+		s = s[:10] + "T" + s[11:]
+	}
+	if strings.HasSuffix(s, "z") {
+		s = s[:len(s)-1] + "Z"
+	}
+	s = yamlShortZone.ReplaceAllString(s, " ${1}0$2")
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
 		}
-		newvars := pongo2.Context{}
-		newvars.Update(cfg.vars)
-		newvars.Update(vars)
-		return tpl.Execute(newvars)
 	}
+	return time.Time{}, fmt.Errorf("cannot parse date %q", fmt.Sprint(v))
 }
 
-func pongoSetup() {
-	pongo2.ReplaceFilter("safe", func(in *pongo2.Value, param *pongo2.Value) (out *pongo2.Value, err *pongo2.Error) {
-		output := strings.Replace(in.String(), "&", "&amp;", -1)
-		output = strings.Replace(output, ">", "&gt;", -1)
-		output = strings.Replace(output, "<", "&lt;", -1)
-		output = strings.Replace(output, "\"", "&quot;", -1)
-		output = strings.Replace(output, "'", "&#39;", -1)
-		return pongo2.AsValue(output), nil
-	})
-	pongo2.ReplaceFilter("escape", func(in *pongo2.Value, param *pongo2.Value) (out *pongo2.Value, err *pongo2.Error) {
-		return in, nil
-	})
-	pongo2.RegisterFilter("xml_escape", func(in *pongo2.Value, param *pongo2.Value) (out *pongo2.Value, err *pongo2.Error) {
-		var b bytes.Buffer
-		xml.Escape(&b, []byte(in.String()))
-		return pongo2.AsValue(b.String()), nil
+var htmlEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	">", "&gt;",
+	"<", "&lt;",
+	"\"", "&quot;",
+	"'", "&#39;",
+)
+
+func htmlEscape(s string) string {
+	return htmlEscaper.Replace(s)
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.Escape(&b, []byte(s))
+	return b.String()
+}
+
+func pongoSetup(cfg *config) {
+	registerJekyllFilters(cfg)
+	registerTags(cfg)
+	registerAssetFilters(cfg)
+	// Autoescaping calls escape without a parameter, while the templates
+	// always pass one. The HTML rendered by jedie is not escaped by it.
+	autoescape := func(in *pongo2.Value) *pongo2.Value {
+		if cfg.safeHTML[in.String()] {
+			return pongo2.AsSafeValue(in.String())
+		}
+		return pongo2.AsSafeValue(htmlEscape(in.String()))
+	}
+	if cfg.LegacyFilters {
+		// Old sites rely on safe to escape and on escape to do nothing.
+		pongo2.ReplaceFilter("safe", func(in *pongo2.Value, param *pongo2.Value) (out *pongo2.Value, err *pongo2.Error) {
+			return pongo2.AsValue(htmlEscape(in.String())), nil
+		})
+		pongo2.ReplaceFilter("escape", func(in *pongo2.Value, param *pongo2.Value) (out *pongo2.Value, err *pongo2.Error) {
+			if param == nil {
+				return autoescape(in), nil
+			}
+			return in, nil
+		})
+	} else {
+		pongo2.ReplaceFilter("safe", func(in *pongo2.Value, param *pongo2.Value) (out *pongo2.Value, err *pongo2.Error) {
+			return in, nil
+		})
+		pongo2.ReplaceFilter("escape", func(in *pongo2.Value, param *pongo2.Value) (out *pongo2.Value, err *pongo2.Error) {
+			if param == nil {
+				return autoescape(in), nil
+			}
+			return pongo2.AsSafeValue(htmlEscape(in.String())), nil
+		})
+	}
+	pongo2.SetAutoescape(cfg.Autoescape)
+	setFilter("xml_escape", func(in *pongo2.Value, param *pongo2.Value) (out *pongo2.Value, err *pongo2.Error) {
+		return pongo2.AsSafeValue(xmlEscape(in.String())), nil
 	})
 	pongo2.RegisterFilter("truncate", func(in *pongo2.Value, param *pongo2.Value) (out *pongo2.Value, err *pongo2.Error) {
 		rs := []rune(in.String())
@@ -180,7 +249,11 @@ func copyFile(src, dst string) (int64, error) {
 }
 
 func urlJoin(l, r string) string {
+	dir := strings.HasSuffix(r, "/")
 	r = path.Clean(r)
+	if dir && r != "/" {
+		r += "/"
+	}
 	ls := strings.HasSuffix(l, "/")
 	rp := strings.HasPrefix(r, "/")
 
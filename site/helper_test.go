@@ -0,0 +1,183 @@
+package site
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/flosch/pongo2"
+)
+
+func TestSTR(t *testing.T) {
+	pongoSetup(&config{})
+	tests := []struct {
+		in  interface{}
+		out string
+	}{
+		{"", ""},
+		{1, ""},
+		{"Dude", "Dude"},
+	}
+
+	for _, test := range tests {
+		actual := str(test.in)
+		if actual != test.out {
+			t.Errorf("expected %v actual %v", test.in, actual)
+		}
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	inFile, err := ioutil.TempFile(os.TempDir(), "dude")
+
+	if err != nil {
+		panic(err)
+	}
+
+	copyFile(inFile.Name(), "muhaha")
+
+	if _, err := os.Stat("muhaha"); os.IsNotExist(err) {
+		t.Errorf("expected %q actual does not exist with error %v", inFile.Name(), err)
+		os.Remove(inFile.Name())
+		return
+	}
+
+	os.Remove(inFile.Name())
+	os.Remove("muhaha")
+}
+
+func TestCopyFileErr(t *testing.T) {
+	in := ""
+
+	_, err := copyFile(in, "")
+
+	if err == nil {
+		t.Errorf("expected copyfile to return nil")
+	}
+
+	inFile, err := ioutil.TempFile(os.TempDir(), "dude")
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer os.Remove(inFile.Name())
+
+	_, err = copyFile(inFile.Name(), "")
+
+	if err == nil {
+		t.Errorf("expected copyfile to return nil")
+	}
+
+}
+
+func TestParseDate(t *testing.T) {
+	loc := time.FixedZone("JST", 9*60*60)
+	tests := []struct {
+		in  interface{}
+		out string
+	}{
+		{"2013-11-22", "2013-11-22T00:00:00+09:00"},
+		{"2013-11-22 21:42", "2013-11-22T21:42:00+09:00"},
+		{"2013-11-22 21:42:47", "2013-11-22T21:42:47+09:00"},
+		{"2013-11-22 21:42:47 +0100", "2013-11-22T21:42:47+01:00"},
+		{"2013-11-22 21:42 -0500", "2013-11-22T21:42:00-05:00"},
+		{"2013-11-22T21:42:47Z", "2013-11-22T21:42:47Z"},
+		{"2013-11-22T21:42:47.5+02:00", "2013-11-22T21:42:47.5+02:00"},
+		{"2013-11-22t21:42:47.10-05:00", "2013-11-22T21:42:47.1-05:00"},
+		{"2013-11-22 21:42:47.10 -5", "2013-11-22T21:42:47.1-05:00"},
+		{"2013-11-22 21:42:47.123 +0900 JST", "2013-11-22T21:42:47.123+09:00"},
+		{time.Date(2013, 11, 22, 12, 0, 0, 0, time.UTC), "2013-11-22T21:00:00+09:00"},
+	}
+
+	for _, test := range tests {
+		actual, err := parseDate(test.in, loc)
+		if err != nil {
+			t.Errorf("%v: %v", test.in, err)
+			continue
+		}
+		if actual.Format(time.RFC3339Nano) != test.out {
+			t.Errorf("expected %v actual %v", test.out, actual.Format(time.RFC3339Nano))
+		}
+	}
+
+	for _, in := range []string{"", "yesterday", "2013/11/22", "2013-11-22 25:00"} {
+		if _, err := parseDate(in, loc); err == nil {
+			t.Errorf("expected parseDate(%q) to fail", in)
+		}
+	}
+}
+
+func TestEscapeFilters(t *testing.T) {
+	defer pongoSetup(&config{})
+
+	tests := []struct {
+		cfg *config
+		in  string
+		out string
+	}{
+		{&config{}, `{{ s }}`, `<b>"&"</b>`},
+		{&config{}, `{{ s|safe }}`, `<b>"&"</b>`},
+		{&config{}, `{{ s|escape }}`, `&lt;b&gt;&quot;&amp;&quot;&lt;/b&gt;`},
+		{&config{}, `{{ s|xml_escape }}`, `&lt;b&gt;&#34;&amp;&#34;&lt;/b&gt;`},
+		{&config{Autoescape: true}, `{{ s }}`, `&lt;b&gt;&quot;&amp;&quot;&lt;/b&gt;`},
+		{&config{Autoescape: true}, `{{ s|safe }}`, `<b>"&"</b>`},
+		{&config{Autoescape: true}, `{{ s|escape }}`, `&lt;b&gt;&quot;&amp;&quot;&lt;/b&gt;`},
+		{&config{Autoescape: true}, `{{ s|xml_escape }}`, `&lt;b&gt;&#34;&amp;&#34;&lt;/b&gt;`},
+		{&config{Autoescape: true}, `{{ content }}`, `<p>content</p>`},
+		{&config{Autoescape: true}, `{% autoescape off %}{{ s }}{% endautoescape %}`, `<b>"&"</b>`},
+		{&config{LegacyFilters: true}, `{{ s }}`, `<b>"&"</b>`},
+		{&config{LegacyFilters: true}, `{{ s|safe }}`, `&lt;b&gt;&quot;&amp;&quot;&lt;/b&gt;`},
+		{&config{LegacyFilters: true}, `{{ s|escape }}`, `<b>"&"</b>`},
+		{&config{LegacyFilters: true, Autoescape: true}, `{{ s }}`, `&lt;b&gt;&quot;&amp;&quot;&lt;/b&gt;`},
+		{&config{LegacyFilters: true, Autoescape: true}, `{{ s|safe }}`, `&lt;b&gt;&quot;&amp;&quot;&lt;/b&gt;`},
+		{&config{LegacyFilters: true, Autoescape: true}, `{{ content }}`, `<p>content</p>`},
+	}
+
+	for _, test := range tests {
+		pongoSetup(test.cfg)
+		e := &pongoEngine{cfg: test.cfg}
+		actual, err := e.renderString("test", test.in, pongo2.Context{
+			"s":       `<b>"&"</b>`,
+			"content": "<p>content</p>",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != test.out {
+			t.Errorf("%s (autoescape=%v legacy=%v): expected %q actual %q", test.in, test.cfg.Autoescape, test.cfg.LegacyFilters, test.out, actual)
+		}
+	}
+}
+
+func TestAutoescapeContent(t *testing.T) {
+	for _, config := range []string{"autoescape: true", "autoescape: true\nlegacy_filters: true"} {
+		fsys := fstest.MapFS{
+			"_config.yml":                {Data: []byte(config)},
+			"_layouts/post.html":         {Data: []byte("<main>{{ page.content }}</main>{{ page.title }}")},
+			"_posts/2024-01-02-hello.md": {Data: []byte("---\nlayout: post\ntitle: <b>\n---\n<em>hi</em>\n")},
+			"feed.xml":                   {Data: []byte("---\n---\n{% for post in site.posts %}<content>{{ post.content }}</content>{% endfor %}")},
+		}
+		out := NewMemoryOutput()
+		s := New(Options{FS: fsys, Output: out, Stdout: ioutil.Discard})
+		if err := s.Load(); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Build(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		for name, want := range map[string]string{
+			"2024/01/02/hello.html": "<main><p><em>hi</em></p>\n</main>&lt;b&gt;",
+			"feed.xml":              "<content><em>hi</em>\n</content>",
+		} {
+			b, _ := out.ReadFile(name)
+			if got := strings.TrimSpace(string(b)); got != want {
+				t.Errorf("%q: %s: want %q but got %q", config, name, want, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package site
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/flosch/pongo2"
+)
+
+// The events of a site.
+const (
+	// PostLoad is the event after a page or post is read. Page is the front
+	// matter and Content is the content of the file; hooks may change both.
+	PostLoad = "post_load"
+	// PreRender is the event before a page or post is rendered. Page is the
+	// page variable of the templates and Content is the content before the
+	// templates and Markdown; hooks may change both.
+	PreRender = "pre_render"
+	// PostRender is the event after a page or post is rendered. Content is
+	// the final output, which hooks may change.
+	PostRender = "post_render"
+	// PostWrite is the event after a file is written to the destination.
+	PostWrite = "post_write"
+	// PostBuild is the event after the site is built.
+	PostBuild = "post_build"
+)
+
+var hookEvents = []string{PostLoad, PreRender, PostRender, PostWrite, PostBuild}
+
+// Event is an event of a site, passed to the hooks.
+type Event struct {
+	// Name is the name of the event, such as PostBuild.
+	Name string
+	// Path is the source file of the page, post or file.
+	Path string
+	// URL is the URL of the page or post.
+	URL string
+	// Dest is the path written in the destination.
+	Dest string
+	// Page is the front matter or the page variable, for PostLoad and
+	// PreRender.
+	Page map[string]interface{}
+	// Content is the content of the page or post, for PostLoad, PreRender
+	// and PostRender.
+	Content string
+}
+
+// Hook is a function called on an event of a site. An error from a hook
+// fails the build.
+type Hook func(ctx context.Context, s *Site, e *Event) error
+
+// hookInput is the event sent to a hook command on stdin.
+type hookInput struct {
+	Event   string                 `json:"event"`
+	Path    string                 `json:"path,omitempty"`
+	URL     string                 `json:"url,omitempty"`
+	Dest    string                 `json:"dest,omitempty"`
+	Page    map[string]interface{} `json:"page,omitempty"`
+	Content string                 `json:"content,omitempty"`
+}
+
+// hookOutput is read from stdout of a hook command. Page is merged into the
+// page and Content replaces the content. Empty output changes nothing.
+type hookOutput struct {
+	Page    map[string]interface{} `json:"page"`
+	Content *string                `json:"content"`
+}
+
+// defaultHookTimeout is the timeout of the hook commands, so that a hung
+// hook does not block the build.
+const defaultHookTimeout = "1m"
+
+// checkHooks checks the events and the timeout of the hook commands of the
+// config, and sets the default timeout.
+func (cfg *config) checkHooks() error {
+	if cfg.HookTimeout == "" {
+		cfg.HookTimeout = defaultHookTimeout
+	}
+	if _, err := parseTimeout(cfg.HookTimeout); err != nil {
+		return fmt.Errorf("hook_timeout: %v", err)
+	}
+	for name, commands := range cfg.Hooks {
+		known := false
+		for _, event := range hookEvents {
+			if name == event {
+				known = true
+			}
+		}
+		if !known {
+			return fmt.Errorf("hooks: unknown event %q", name)
+		}
+		for _, command := range commands {
+			if len(command) == 0 {
+				return fmt.Errorf("hooks: %s: command is required", name)
+			}
+		}
+	}
+	return nil
+}
+
+// hasHooks returns true if a hook command or function is registered for the
+// event.
+func (cfg *config) hasHooks(name string) bool {
+	if len(cfg.Hooks[name]) > 0 {
+		return true
+	}
+	return cfg.site != nil && len(cfg.site.hooks[name]) > 0
+}
+
+// fire calls the hook commands of the config for the event, then the hook
+// functions of the site.
+func (cfg *config) fire(ctx context.Context, e *Event) error {
+	for _, command := range cfg.Hooks[e.Name] {
+		if err := cfg.runHook(ctx, command, e); err != nil {
+			return fmt.Errorf("%s hook %s: %v", e.Name, command[0], err)
+		}
+	}
+	if cfg.site == nil {
+		return nil
+	}
+	for _, hook := range cfg.site.hooks[e.Name] {
+		if err := hook(ctx, cfg.site, e); err != nil {
+			return fmt.Errorf("%s hook: %v", e.Name, err)
+		}
+	}
+	return nil
+}
+
+// runHook runs the hook command with the event on stdin, without a shell, in
+// the source directory, and applies the changes from its output to the
+// event. The command is killed after HookTimeout.
+func (cfg *config) runHook(ctx context.Context, command []string, e *Event) error {
+	input := hookInput{
+		Event:   e.Name,
+		Path:    e.Path,
+		URL:     e.URL,
+		Dest:    e.Dest,
+		Content: e.Content,
+	}
+	if e.Page != nil {
+		input.Page = jsonValue(map[string]interface{}(e.Page)).(map[string]interface{})
+	}
+	// The content is mostly HTML, so it is sent as is.
+	var stdin bytes.Buffer
+	enc := json.NewEncoder(&stdin)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(input); err != nil {
+		return err
+	}
+
+	// Sites not on the disk have no directory to run in.
+	var dir string
+	if cfg.onDisk {
+		dir = cfg.Source
+	}
+	d, _ := parseTimeout(cfg.HookTimeout)
+	stdout, err := execCommand(ctx, dir, command, nil, d, stdin.Bytes())
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(stdout)) == 0 {
+		return nil
+	}
+	var output hookOutput
+	if err := json.Unmarshal(stdout, &output); err != nil {
+		return fmt.Errorf("invalid output: %v", err)
+	}
+	if len(output.Page) > 0 {
+		if e.Page == nil {
+			e.Page = map[string]interface{}{}
+		}
+		for k, v := range output.Page {
+			e.Page[k] = fromJSON(v)
+		}
+	}
+	if output.Content != nil {
+		e.Content = *output.Content
+	}
+	return nil
+}
+
+// postLoad fires PostLoad for the page or post from read from its file. The
+// page is kept as a virtual page when hooks may have changed it, so that it
+// is rendered as changed.
+func (cfg *config) postLoad(ctx context.Context, from string, vars pongo2.Context, content string) (string, error) {
+	if !cfg.hasHooks(PostLoad) {
+		return content, nil
+	}
+	e := &Event{Name: PostLoad, Path: from, Page: vars, Content: content}
+	if err := cfg.fire(ctx, e); err != nil {
+		return "", err
+	}
+	page := pongo2.Context{}
+	for k, v := range e.Page {
+		vars[k] = v
+		page[k] = v
+	}
+	cfg.virtual[from] = virtualPage{vars: page, content: e.Content}
+	return e.Content, nil
+}
+
+// writeFile writes data to the path to in the destination, and fires
+// PostWrite.
+func (cfg *config) writeFile(ctx context.Context, from, to string, data []byte) error {
+	data = cfg.minifyOutput(to, data)
+	if err := cfg.writeOutput(to, data); err != nil {
+		return err
+	}
+	return cfg.postWrite(ctx, from, to)
+}
+
+func (cfg *config) postWrite(ctx context.Context, from, to string) error {
+	if !cfg.hasHooks(PostWrite) {
+		return nil
+	}
+	return cfg.fire(ctx, &Event{Name: PostWrite, Path: from, URL: cfg.destURL(to), Dest: to})
+}
+
+// destURL returns the URL of the path to in the destination.
+func (cfg *config) destURL(to string) string {
+	p := strings.TrimPrefix(to, cfg.Destination)
+	p = strings.TrimSuffix(p, "index.html")
+	return urlJoin(cfg.Baseurl, p)
+}
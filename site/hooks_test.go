@@ -0,0 +1,150 @@
+package site
+
+import (
+	"context"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestHooks(t *testing.T) {
+	fsys := fstest.MapFS{
+		"_config.yml":                {Data: []byte("name: jedie\npermalink: pretty")},
+		"_layouts/default.html":      {Data: []byte("<title>{{ page.title }}</title>{{ content }}</body>")},
+		"_posts/2013-11-23-hello.md": {Data: []byte("---\nlayout: default\ntitle: Hello\n---\n*hello* [[name]]")},
+	}
+	out := NewMemoryOutput()
+	s := New(Options{FS: fsys, Output: out, Stdout: ioutil.Discard})
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	var events, written []string
+	s.On(PostLoad, func(ctx context.Context, s *Site, e *Event) error {
+		events = append(events, e.Name)
+		e.Page["title"] = e.Page["title"].(string) + "!"
+		return nil
+	})
+	s.On(PreRender, func(ctx context.Context, s *Site, e *Event) error {
+		events = append(events, e.Name)
+		e.Content = strings.Replace(e.Content, "[[name]]", "{{ site.name }}", -1)
+		return nil
+	})
+	s.On(PostRender, func(ctx context.Context, s *Site, e *Event) error {
+		events = append(events, e.Name)
+		if e.URL != "/2013/11/23/hello/" {
+			t.Errorf("want the URL of the post but got %q", e.URL)
+		}
+		e.Content = strings.Replace(e.Content, "</body>", "<script>analytics()</script></body>", 1)
+		return nil
+	})
+	s.On(PostWrite, func(ctx context.Context, s *Site, e *Event) error {
+		written = append(written, strings.TrimPrefix(e.Dest, s.Destination()+"/"))
+		return nil
+	})
+	s.On(PostBuild, func(ctx context.Context, s *Site, e *Event) error {
+		events = append(events, e.Name)
+		return nil
+	})
+	if err := s.Build(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := strings.Join(events, " "), "post_load pre_render post_render post_build"; got != want {
+		t.Fatalf("want events %q but got %q", want, got)
+	}
+	sort.Strings(written)
+	if got, want := strings.Join(written, " "), strings.Join(out.Names(), " "); got != want {
+		t.Fatalf("want %q written but got %q", want, got)
+	}
+	b, _ := out.ReadFile("2013/11/23/hello/index.html")
+	want := "<title>Hello!</title><p><em>hello</em> jedie</p>\n<script>analytics()</script></body>"
+	if got := strings.TrimSpace(string(b)); got != want {
+		t.Fatalf("want %q but got %q", want, got)
+	}
+}
+
+func TestHookCommands(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook scripts need sh")
+	}
+	tests := []struct {
+		script string
+		want   string
+		err    string
+	}{
+		{
+			"#!/bin/sh\ncase \"$(cat)\" in\n*'\"event\":\"post_render\"'*'\"url\":\"/about.html\"'*'\"content\":\"<p>about</p>\"'*) ;;\n*) exit 1;;\nesac\necho '{\"content\": \"<p>rewritten</p>\"}'\n",
+			"<p>rewritten</p>",
+			"",
+		},
+		{"#!/bin/sh\ncat >/dev/null\n", "<p>about</p>", ""},
+		{"#!/bin/sh\necho boom >&2\nexit 1\n", "", "post_render hook sh: exit status 1: boom"},
+		{"#!/bin/sh\necho nothing\n", "", "post_render hook sh: invalid output"},
+		{"#!/bin/sh\nsleep 5\n", "", "post_render hook sh: timed out after 100ms"},
+	}
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "jedie")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		script := filepath.Join(dir, "hook.sh")
+		if err := ioutil.WriteFile(script, []byte(test.script), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		fsys := fstest.MapFS{
+			"_config.yml": {Data: []byte("hook_timeout: 100ms\nhooks:\n  post_render:\n    - [sh, " + filepath.ToSlash(script) + "]")},
+			"about.html":  {Data: []byte("---\ntitle: About\n---\n<p>about</p>")},
+			"_posts":      {Mode: fs.ModeDir},
+		}
+		out := NewMemoryOutput()
+		s := New(Options{FS: fsys, Output: out, Stdout: ioutil.Discard})
+		if err := s.Load(); err != nil {
+			t.Fatal(err)
+		}
+		err = s.Build(context.Background())
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("want error %q but got %v", test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := out.ReadFile("about.html")
+		if got := strings.TrimSpace(string(b)); got != test.want {
+			t.Fatalf("want %q but got %q", test.want, got)
+		}
+	}
+
+	// The commands run in the source directory.
+	dir, cfg := makeSite("hooks:\n  post_build:\n    - [sh, -c, 'cat >/dev/null; touch hooked']", map[string]string{
+		"_posts/2013-11-23-hello.md": "---\n---\nhello",
+	})
+	defer os.RemoveAll(dir)
+	if err := cfg.build(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "hooked")); err != nil {
+		t.Fatalf("want the hook run in the source directory but got %v", err)
+	}
+
+	for config, want := range map[string]string{
+		"hooks:\n  pre_build:\n    - [true]":                      `unknown event "pre_build"`,
+		"hook_timeout: soon\nhooks:\n  post_build:\n    - [true]": "hook_timeout: timeout: ",
+	} {
+		s := New(Options{FS: fstest.MapFS{"_config.yml": {Data: []byte(config)}}, Output: NewMemoryOutput()})
+		if err := s.Load(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%q: want an error %q but got %v", config, want, err)
+		}
+	}
+}
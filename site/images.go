@@ -0,0 +1,569 @@
+package site
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/flosch/pongo2"
+	"github.com/osteele/liquid/render"
+	"golang.org/x/image/draw"
+)
+
+// images configures the responsive variants of the JPEG and PNG images. The
+// images in Dirs of the source directory, and the images of the image tag,
+// are written resized to Widths narrower than the image, with the Exif
+// metadata stripped. The image itself is written with the metadata segments
+// removed but not encoded again, unless it is turned upright by the Exif
+// orientation:
+//
+//	images:
+//	  dirs: [images]
+//	  widths: [480, 960, 1600]
+//	  quality: 85
+//	  sizes: "(max-width: 960px) 100vw, 960px"
+type images struct {
+	Dirs    []string `yaml:"dirs"`
+	Widths  []int    `yaml:"widths"`
+	Quality int      `yaml:"quality"`
+	Sizes   string   `yaml:"sizes"`
+}
+
+// imageSet is an image and its variants.
+type imageSet struct {
+	from    string
+	width   int
+	height  int
+	outputs []imageOutput
+	written bool
+}
+
+// imageOutput is a variant of an image, the image itself last.
+type imageOutput struct {
+	to     string
+	url    string
+	width  int
+	height int
+	data   []byte
+}
+
+// checkImages checks the config of the images, and sets the defaults.
+func (cfg *config) checkImages() error {
+	if len(cfg.Images.Widths) == 0 {
+		cfg.Images.Widths = []int{480, 960, 1600}
+	}
+	for _, w := range cfg.Images.Widths {
+		if w <= 0 {
+			return fmt.Errorf("images: invalid width %d", w)
+		}
+	}
+	if cfg.Images.Quality == 0 {
+		cfg.Images.Quality = 85
+	}
+	if cfg.Images.Quality < 1 || cfg.Images.Quality > 100 {
+		return fmt.Errorf("images: quality must be 1 to 100")
+	}
+	if cfg.Images.Sizes == "" {
+		cfg.Images.Sizes = "100vw"
+	}
+	return nil
+}
+
+func isImage(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+// inImageDirs returns true if the file is an image in the image directories.
+func (cfg *config) inImageDirs(from string) bool {
+	if !isImage(from) {
+		return false
+	}
+	rel := cfg.sourceRel(from)
+	for _, dir := range cfg.Images.Dirs {
+		dir = strings.Trim(path.Clean("/"+dir), "/")
+		if rel != "" && (dir == "" || strings.HasPrefix(rel, dir+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// processImages makes the variants of the images in the image directories.
+func (cfg *config) processImages(pages []pongo2.Context) error {
+	cfg.images = map[string]*imageSet{}
+	if len(cfg.Images.Dirs) == 0 {
+		return nil
+	}
+	for _, page := range pages {
+		from := page["path"].(string)
+		if !cfg.inImageDirs(from) {
+			continue
+		}
+		if _, err := cfg.processImage(from); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processImage returns the image and its variants, making them at the first
+// call in a build. The variants are cached by the content of the image.
+func (cfg *config) processImage(from string) (*imageSet, error) {
+	if set, ok := cfg.images[from]; ok {
+		return set, nil
+	}
+	if cfg.images == nil {
+		cfg.images = map[string]*imageSet{}
+	}
+	rel := cfg.sourceRel(from)
+	if rel == "" {
+		return nil, fmt.Errorf("%s: outside of the source directory", from)
+	}
+	if !isImage(from) {
+		return nil, fmt.Errorf("%s: not a JPEG or PNG image", from)
+	}
+	b, err := cfg.readFile(from)
+	if err != nil {
+		return nil, err
+	}
+	conf, format, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", from, err)
+	}
+	orientation := 1
+	if format == "jpeg" {
+		orientation = exifOrientation(b)
+	}
+	set := &imageSet{from: from, width: conf.Width, height: conf.Height}
+	if orientation >= 5 {
+		set.width, set.height = set.height, set.width
+	}
+
+	var widths []int
+	for _, w := range cfg.Images.Widths {
+		if w < set.width {
+			widths = append(widths, w)
+		}
+	}
+	sort.Ints(widths)
+	widths = append(widths, set.width)
+
+	var img image.Image
+	ext := path.Ext(rel)
+	for i, w := range widths {
+		if i > 0 && w == widths[i-1] {
+			continue
+		}
+		h := int(math.Round(float64(set.height) * float64(w) / float64(set.width)))
+		if h < 1 {
+			h = 1
+		}
+		name := rel
+		if w != set.width {
+			name = fmt.Sprintf("%s-%dw%s", strings.TrimSuffix(rel, ext), w, ext)
+		}
+
+		key := cfg.imageKey(b, format, w)
+		data, ok := []byte(nil), false
+		if w == set.width && orientation < 2 {
+			data, ok = stripMetadata(b, format), true
+		} else if cfg.cacheDir() != "" {
+			data, ok = cfg.cacheGet(key)
+		}
+		if !ok {
+			if img == nil {
+				if img, _, err = image.Decode(bytes.NewReader(b)); err != nil {
+					return nil, fmt.Errorf("%s: %v", from, err)
+				}
+				img = orient(img, orientation)
+			}
+			if data, err = cfg.encodeImage(resize(img, w, h), format); err != nil {
+				return nil, fmt.Errorf("%s: %v", from, err)
+			}
+			if cfg.cacheDir() != "" {
+				if err := cfg.cachePut(key, data); err != nil {
+					cfg.warnf("cache: %v", err)
+				}
+			}
+		}
+		set.outputs = append(set.outputs, imageOutput{
+			to:     cfg.Destination + "/" + name,
+			url:    urlJoin(cfg.Baseurl, "/"+name),
+			width:  w,
+			height: h,
+			data:   data,
+		})
+	}
+	// The variants of the images of the image tag are known only after
+	// checkOutputs.
+	if cfg.outputs != nil {
+		for _, o := range set.outputs[:len(set.outputs)-1] {
+			if err := cfg.claimOutput(o.to, from, o.url); err != nil {
+				return nil, err
+			}
+		}
+	}
+	cfg.images[from] = set
+	return set, nil
+}
+
+// stripMetadata returns the image without the metadata, such as Exif, XMP
+// and the comments, keeping the image data as is.
+func stripMetadata(b []byte, format string) []byte {
+	if format == "png" {
+		return stripPNG(b)
+	}
+	return stripJPEG(b)
+}
+
+// stripJPEG removes the APPn and COM segments of the JPEG image, except for
+// JFIF, the ICC profile and Adobe which affect the colors. The image is
+// returned as is if it is not understood.
+func stripJPEG(b []byte) []byte {
+	if len(b) < 4 || b[0] != 0xff || b[1] != 0xd8 {
+		return b
+	}
+	out := append([]byte{}, b[:2]...)
+	for i := 2; i+4 <= len(b); {
+		if b[i] != 0xff {
+			return b
+		}
+		marker := b[i+1]
+		if marker == 0xda {
+			// The image data starts; the metadata is before it.
+			return append(out, b[i:]...)
+		}
+		size := int(binary.BigEndian.Uint16(b[i+2:]))
+		if size < 2 || i+2+size > len(b) {
+			return b
+		}
+		switch {
+		case marker == 0xfe, marker >= 0xe1 && marker <= 0xef && marker != 0xe2 && marker != 0xee:
+		default:
+			out = append(out, b[i:i+2+size]...)
+		}
+		i += 2 + size
+	}
+	return b
+}
+
+// stripPNG removes the text, Exif and time chunks of the PNG image. The
+// image is returned as is if it is not understood.
+func stripPNG(b []byte) []byte {
+	if len(b) < 8 || string(b[:8]) != "\x89PNG\r\n\x1a\n" {
+		return b
+	}
+	out := append([]byte{}, b[:8]...)
+	for i := 8; i+12 <= len(b); {
+		n := int(binary.BigEndian.Uint32(b[i:]))
+		if n < 0 || n > len(b)-i-12 {
+			return b
+		}
+		typ := string(b[i+4 : i+8])
+		switch typ {
+		case "tEXt", "zTXt", "iTXt", "eXIf", "tIME":
+		default:
+			out = append(out, b[i:i+12+n]...)
+		}
+		if typ == "IEND" {
+			return out
+		}
+		i += 12 + n
+	}
+	return b
+}
+
+// imageKey returns the cache key of the variant of the image at the width.
+func (cfg *config) imageKey(b []byte, format string, width int) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "jedie image 1\x00%s\x00%d\x00%d\x00", format, width, cfg.Images.Quality)
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// encodeImage encodes the image without metadata.
+func (cfg *config) encodeImage(img image.Image, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if format == "png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: cfg.Images.Quality})
+	}
+	return buf.Bytes(), err
+}
+
+func resize(img image.Image, w, h int) image.Image {
+	if b := img.Bounds(); b.Dx() == w && b.Dy() == h {
+		return img
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Over, nil)
+	return dst
+}
+
+// orient turns the image upright by the Exif orientation, since the
+// orientation is stripped with the other metadata.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+// exifOrientation returns the orientation of the JPEG image in its Exif
+// metadata, or 1 if it has none.
+func exifOrientation(b []byte) int {
+	if len(b) < 4 || b[0] != 0xff || b[1] != 0xd8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(b); {
+		if b[i] != 0xff {
+			return 1
+		}
+		marker := b[i+1]
+		if marker == 0xda || marker == 0xd9 {
+			// The image data starts; the metadata is before it.
+			return 1
+		}
+		size := int(binary.BigEndian.Uint16(b[i+2:]))
+		if size < 2 || i+2+size > len(b) {
+			return 1
+		}
+		seg := b[i+4 : i+2+size]
+		if marker == 0xe1 && len(seg) > 6 && string(seg[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(seg[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+// tiffOrientation returns the orientation tag of the first IFD of the TIFF
+// structure of Exif.
+func tiffOrientation(t []byte) int {
+	if len(t) < 8 {
+		return 1
+	}
+	var bo binary.ByteOrder
+	switch string(t[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return 1
+	}
+	off := int(bo.Uint32(t[4:]))
+	if off < 8 || off+2 > len(t) {
+		return 1
+	}
+	n := int(bo.Uint16(t[off:]))
+	for j := 0; j < n; j++ {
+		e := off + 2 + j*12
+		if e+12 > len(t) {
+			break
+		}
+		if bo.Uint16(t[e:]) == 0x0112 {
+			if o := int(bo.Uint16(t[e+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			break
+		}
+	}
+	return 1
+}
+
+// writeImages writes the image and its variants.
+func (cfg *config) writeImages(ctx context.Context, set *imageSet) error {
+	for _, o := range set.outputs {
+		if err := cfg.writeFile(ctx, set.from, o.to, o.data); err != nil {
+			return err
+		}
+	}
+	set.written = true
+	return nil
+}
+
+// imageNames returns the sorted paths of the images processed.
+func (cfg *config) imageNames() []string {
+	names := make([]string, 0, len(cfg.images))
+	for name := range cfg.images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// imageTag returns the img element of the image at the path relative to the
+// source directory, with the srcset of its variants and its size. The
+// attributes are added to the element, and sizes overrides the sizes of the
+// config.
+func (cfg *config) imageTag(name string, attrs map[string]string) (string, error) {
+	name = strings.TrimPrefix(strings.TrimSpace(name), "/")
+	set, err := cfg.processImage(cfg.lookupSource(name))
+	if err != nil {
+		return "", fmt.Errorf("image: %v", err)
+	}
+	img := set.outputs[len(set.outputs)-1]
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<img src="%s"`, htmlEscape(img.url))
+	if len(set.outputs) > 1 {
+		var srcset []string
+		for _, o := range set.outputs {
+			srcset = append(srcset, o.url+" "+strconv.Itoa(o.width)+"w")
+		}
+		sizes := cfg.Images.Sizes
+		if s, ok := attrs["sizes"]; ok {
+			sizes = s
+		}
+		fmt.Fprintf(&buf, ` srcset="%s" sizes="%s"`, htmlEscape(strings.Join(srcset, ", ")), htmlEscape(sizes))
+	}
+	fmt.Fprintf(&buf, ` width="%d" height="%d"`, img.width, img.height)
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		switch k {
+		case "src", "srcset", "sizes", "width", "height":
+		default:
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&buf, ` %s="%s"`, k, htmlEscape(attrs[k]))
+	}
+	buf.WriteString(">")
+	return buf.String(), nil
+}
+
+type tagImageNode struct {
+	cfg    *config
+	token  *pongo2.Token
+	name   string
+	params map[string]pongo2.IEvaluator
+}
+
+func (node *tagImageNode) Execute(ctx *pongo2.ExecutionContext, writer pongo2.TemplateWriter) *pongo2.Error {
+	attrs := map[string]string{}
+	for k, v := range node.params {
+		value, err := v.Evaluate(ctx)
+		if err != nil {
+			return err
+		}
+		attrs[k] = value.String()
+	}
+	s, err := node.cfg.imageTag(node.name, attrs)
+	if err != nil {
+		return ctx.Error(err.Error(), node.token)
+	}
+	writer.WriteString(s)
+	return nil
+}
+
+// imageTag returns the image tag, taking the path of the image and the
+// attributes of the img element:
+//
+//	{% image images/photo.jpg alt=page.title class="wide" %}
+func imageTag(cfg *config) pongo2.TagParser {
+	return func(doc *pongo2.Parser, start *pongo2.Token, arguments *pongo2.Parser) (pongo2.INodeTag, *pongo2.Error) {
+		node := &tagImageNode{cfg: cfg, token: start, params: map[string]pongo2.IEvaluator{}}
+		isParam := func() bool {
+			return arguments.PeekType(pongo2.TokenIdentifier) != nil && arguments.PeekN(1, pongo2.TokenSymbol, "=") != nil
+		}
+		if t := arguments.MatchType(pongo2.TokenString); t != nil {
+			node.name = t.Val
+		} else {
+			for arguments.Remaining() > 0 && !isParam() {
+				node.name += arguments.Current().Val
+				arguments.Consume()
+			}
+		}
+		if node.name == "" {
+			return nil, arguments.Error("image path is required", start)
+		}
+		for arguments.Remaining() > 0 {
+			key := arguments.MatchType(pongo2.TokenIdentifier)
+			if key == nil || arguments.Match(pongo2.TokenSymbol, "=") == nil {
+				return nil, arguments.Error("expected key=value", nil)
+			}
+			value, err := arguments.ParseExpression()
+			if err != nil {
+				return nil, err
+			}
+			node.params[key.Val] = value
+		}
+		return node, nil
+	}
+}
+
+// liquidImageTag is the image tag for Liquid.
+func liquidImageTag(cfg *config) func(render.Context) (string, error) {
+	return func(ctx render.Context) (string, error) {
+		args, err := ctx.ExpandTagArg()
+		if err != nil {
+			return "", err
+		}
+		args = strings.TrimSpace(args)
+		name, rest := args, ""
+		if i := strings.IndexAny(args, " \t\n"); i >= 0 {
+			name, rest = args[:i], args[i:]
+		}
+		attrs := map[string]string{}
+		for _, m := range includeParam.FindAllStringSubmatch(rest, -1) {
+			v, err := ctx.EvaluateString(m[2])
+			if err != nil {
+				return "", err
+			}
+			attrs[m[1]] = fmt.Sprint(v)
+		}
+		s, err := cfg.imageTag(strings.Trim(name, `"'`), attrs)
+		if err != nil {
+			return "", ctx.WrapError(err)
+		}
+		return s, nil
+	}
+}
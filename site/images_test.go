@@ -0,0 +1,248 @@
+package site
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// testImage returns an image of w by h, red on the left half and blue on the
+// right half.
+func testImage(w, h int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{255, 0, 0, 255}
+			if x >= w/2 {
+				c = color.NRGBA{0, 0, 255, 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// withOrientation returns the JPEG with Exif metadata of the orientation.
+func withOrientation(b []byte, orientation byte) []byte {
+	tiff := []byte{
+		'M', 'M', 0, 42, 0, 0, 0, 8,
+		0, 1,
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, orientation, 0, 0,
+		0, 0, 0, 0,
+	}
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := append([]byte{0xff, 0xe1, byte((len(seg) + 2) >> 8), byte(len(seg) + 2)}, seg...)
+	return append(append(append([]byte{}, b[:2]...), app1...), b[2:]...)
+}
+
+func TestImages(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(200, 100), nil); err != nil {
+		t.Fatal(err)
+	}
+	photo := withOrientation(buf.Bytes(), 6)
+	if got := exifOrientation(photo); got != 6 {
+		t.Fatalf("want orientation 6 but got %d", got)
+	}
+	buf.Reset()
+	if err := png.Encode(&buf, testImage(80, 40)); err != nil {
+		t.Fatal(err)
+	}
+	icon := buf.Bytes()
+
+	tests := []struct {
+		engine string
+		page   string
+	}{
+		{"pongo2", `{% image "logo.png" alt=page.title class="wide" %}`},
+		{"liquid", `{% image logo.png alt=page.title class="wide" %}`},
+	}
+	for _, test := range tests {
+		fsys := fstest.MapFS{
+			"_config.yml":      {Data: []byte("template_engine: " + test.engine + "\nimages:\n  dirs: [images]\n  widths: [50, 400]")},
+			"_posts":           {Mode: fs.ModeDir},
+			"images/photo.jpg": {Data: photo},
+			"logo.png":         {Data: icon},
+			"index.html":       {Data: []byte("---\ntitle: A & B\n---\n" + test.page + "\n")},
+		}
+		out := NewMemoryOutput()
+		var stdout bytes.Buffer
+		s := New(Options{FS: fsys, Output: out, Stdout: &stdout})
+		if err := s.Load(); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Build(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		for name, want := range map[string]image.Point{
+			"images/photo-50w.jpg": {50, 100},
+			"images/photo.jpg":     {100, 200},
+			"logo-50w.png":         {50, 25},
+			"logo.png":             {80, 40},
+		} {
+			b, ok := out.ReadFile(name)
+			if !ok {
+				t.Fatalf("%s: %s: not written, got %v", test.engine, name, out.Names())
+			}
+			img, _, err := image.Decode(bytes.NewReader(b))
+			if err != nil {
+				t.Fatalf("%s: %s: %v", test.engine, name, err)
+			}
+			if got := img.Bounds().Size(); got != want {
+				t.Fatalf("%s: %s: want %v but got %v", test.engine, name, want, got)
+			}
+			if bytes.Contains(b, []byte("Exif")) {
+				t.Fatalf("%s: %s: want the Exif metadata stripped", test.engine, name)
+			}
+		}
+		if _, ok := out.ReadFile("images/photo-400w.jpg"); ok {
+			t.Fatalf("%s: want no variant wider than the image", test.engine)
+		}
+		if b, _ := out.ReadFile("logo.png"); !bytes.Equal(b, icon) {
+			t.Fatalf("%s: want the image written as is", test.engine)
+		}
+		if n := strings.Count(stdout.String(), "logo.png =>"); n != 1 {
+			t.Fatalf("%s: want logo.png written once but got %d times", test.engine, n)
+		}
+
+		// Turned upright, the red half is at the top.
+		b, _ := out.ReadFile("images/photo.jpg")
+		img, _ := jpeg.Decode(bytes.NewReader(b))
+		if r, _, bl, _ := img.At(50, 20).RGBA(); r < bl {
+			t.Fatalf("%s: want the image turned by the orientation", test.engine)
+		}
+
+		b, _ = out.ReadFile("index.html")
+		want := `<img src="/logo.png" srcset="/logo-50w.png 50w, /logo.png 80w" sizes="100vw" width="80" height="40" alt="A &amp; B" class="wide">`
+		if got := strings.TrimSpace(string(b)); got != want {
+			t.Fatalf("%s: want %q but got %q", test.engine, want, got)
+		}
+	}
+
+	for _, config := range []string{
+		"images:\n  widths: [0]",
+		"images:\n  quality: 101",
+	} {
+		s := New(Options{FS: fstest.MapFS{"_config.yml": {Data: []byte(config)}}, Output: NewMemoryOutput()})
+		if err := s.Load(); err == nil || !strings.HasPrefix(err.Error(), "images: ") {
+			t.Errorf("%q: want an images error but got %v", config, err)
+		}
+	}
+}
+
+func TestImageCache(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(80, 40)); err != nil {
+		t.Fatal(err)
+	}
+	dir, cfg := makeSite("images:\n  dirs: [images]\n  widths: [20, 40]", map[string]string{
+		"images/a.png": buf.String(),
+		"_posts/.keep": "",
+	})
+	defer os.RemoveAll(dir)
+	cfg.stdout = ioutil.Discard
+	s := &Site{cfg: cfg, hooks: map[string][]Hook{}}
+
+	if err := cfg.build(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := s.CacheStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The image itself is not encoded again, and not cached.
+	if stats.Entries != 2 {
+		t.Fatalf("want 2 entries but got %d", stats.Entries)
+	}
+
+	// The variants cached are used as they are.
+	key := cfg.imageKey(buf.Bytes(), "png", 20)
+	if err := ioutil.WriteFile(cachePath(cfg.CacheDir, key), []byte("cached"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.build(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "_site", "images", "a-20w.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "cached" {
+		t.Fatalf("want the variant from the cache but got %d bytes", len(b))
+	}
+}
+
+func TestImageMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(40, 20), nil); err != nil {
+		t.Fatal(err)
+	}
+	photo := append([]byte{}, buf.Bytes()...)
+	buf.Reset()
+	if err := png.Encode(&buf, testImage(40, 20)); err != nil {
+		t.Fatal(err)
+	}
+	icon := buf.Bytes()
+	// A tEXt chunk after IHDR.
+	text := []byte{0, 0, 0, 5, 't', 'E', 'X', 't', 'a', 0, 'b', 'c', 'd'}
+	text = binary.BigEndian.AppendUint32(text, crc32.ChecksumIEEE(text[4:]))
+	tagged := append(append(append([]byte{}, icon[:33]...), text...), icon[33:]...)
+
+	fsys := fstest.MapFS{
+		"_config.yml":      {Data: []byte("images:\n  dirs: [images]\n  widths: [20]")},
+		"_posts":           {Mode: fs.ModeDir},
+		"images/photo.jpg": {Data: withOrientation(photo, 1)},
+		"images/icon.png":  {Data: tagged},
+	}
+	out := NewMemoryOutput()
+	s := New(Options{FS: fsys, Output: out, Stdout: ioutil.Discard})
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Build(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string][]byte{
+		"images/photo.jpg": photo,
+		"images/icon.png":  icon,
+	} {
+		if b, _ := out.ReadFile(name); !bytes.Equal(b, want) {
+			t.Errorf("%s: want the image without the metadata as is", name)
+		}
+	}
+}
+
+func TestImageCollision(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(80, 40)); err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"_config.yml":  {Data: []byte("images:\n  widths: [50]")},
+		"_posts":       {Mode: fs.ModeDir},
+		"logo.png":     {Data: buf.Bytes()},
+		"logo-50w.png": {Data: buf.Bytes()},
+		"index.html":   {Data: []byte(`{% image "logo.png" %}`)},
+	}
+	s := New(Options{FS: fsys, Output: NewMemoryOutput(), Stdout: ioutil.Discard})
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	err := s.Build(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "logo-50w.png is written by both") {
+		t.Fatalf("want a collision but got %v", err)
+	}
+}
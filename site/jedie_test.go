@@ -0,0 +1,260 @@
+package site
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flosch/pongo2"
+)
+
+func makeTmpDir() string {
+	dir, err := ioutil.TempDir(os.TempDir(), "jedie")
+	if err != nil {
+		panic(err)
+	}
+	return dir
+}
+
+func makeConfig(content string) string {
+	dir := makeTmpDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "_config.yml"), []byte(strings.TrimSpace(content)), 0644)
+	if err != nil {
+		panic(err)
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := makeConfig(`
+name: Your New Jedie Site
+description: You love golang, I love golang
+permalink: /foo/:categories/:month/:title.html
+	`)
+	defer os.RemoveAll(dir)
+
+	cfg := config{}
+	err := cfg.load(filepath.Join(dir, "_config.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Name != "Your New Jedie Site" {
+		t.Fatalf("Unexpected cfg.Name: %s", cfg.Name)
+	}
+}
+
+func TestLoadFailed(t *testing.T) {
+	dir := makeConfig(`
+name: Your New Jedie Site
+description: You love golang, I love golang
+permalink: /foo/:categories/:month/:title.html
+	`)
+	defer os.RemoveAll(dir)
+
+	cfg := config{}
+	err := cfg.load(filepath.Join(dir, "__config.yml"))
+	if err == nil {
+		t.Fatalf("Should be failed: %v", err)
+	}
+
+	if cfg.Name != "" {
+		t.Fatalf("Unexpected cfg.Name: %s", cfg.Name)
+	}
+}
+
+func TestLoadTimezone(t *testing.T) {
+	dir := makeConfig(`
+name: Your New Jedie Site
+timezone: Asia/Tokyo
+	`)
+	defer os.RemoveAll(dir)
+
+	cfg := config{}
+	err := cfg.load(filepath.Join(dir, "_config.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date, err := cfg.toDate(filepath.Join(dir, "2013-11-23-welcome.md"), pongo2.Context{"date": "2013-11-22 21:42:47"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if date.Format(time.RFC3339) != "2013-11-22T21:42:47+09:00" {
+		t.Fatalf("Unexpected date: %v", date)
+	}
+
+	date, err = cfg.toDate(filepath.Join(dir, "_config.yml"), pongo2.Context{"date": "next tuesday"})
+	if err == nil {
+		t.Fatalf("Should be failed: %v", date)
+	}
+}
+
+func TestNew(t *testing.T) {
+	dir := makeTmpDir()
+	defer os.RemoveAll(dir)
+
+	err := Create(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "_config.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIsMarkdown(t *testing.T) {
+	tests := []struct {
+		in  string
+		out bool
+	}{
+		{"dude.md", true},
+		{"dude.mkd", true},
+		{"dude.markdown", true},
+		{"dude.dude", false},
+	}
+
+	cfg := config{}
+	for _, test := range tests {
+		actual := cfg.isMarkdown(test.in)
+		if actual != test.out {
+			t.Errorf("expected %v actual %v", test.out, actual)
+		}
+	}
+}
+
+func TestIsConvertable(t *testing.T) {
+	tests := []struct {
+		in  string
+		out bool
+	}{
+		{"dude.html", true},
+		{"dude.xml", true},
+		{"dude.md", true},
+		{"dude.markdown", true},
+		{"dude.dude", false},
+	}
+
+	cfg := config{}
+	for _, test := range tests {
+		actual := cfg.isConvertable(test.in)
+		if actual != test.out {
+			t.Errorf("expected %v actual %v", test.out, actual)
+		}
+	}
+}
+
+func TestPermalink(t *testing.T) {
+	cfg := config{
+		Source:      "/src",
+		Destination: "/src/_site",
+		Posts:       "/src/_posts",
+		loc:         time.UTC,
+	}
+	post := "/src/_posts/2013-11-23-welcome-to-jedie.md"
+	date := "2013-11-23 04:05:06"
+	tests := []struct {
+		pattern string
+		from    string
+		vars    pongo2.Context
+		out     string
+	}{
+		{permalinkStyle("date"), post, pongo2.Context{"date": date}, "/2013/11/23/welcome-to-jedie.html"},
+		{permalinkStyle("pretty"), post, pongo2.Context{"date": date}, "/2013/11/23/welcome-to-jedie/"},
+		{permalinkStyle("ordinal"), post, pongo2.Context{"date": date}, "/2013/327/welcome-to-jedie.html"},
+		{permalinkStyle("none"), post, pongo2.Context{"date": date, "category": "go"}, "/go/welcome-to-jedie.html"},
+		{"/:categories/:title/", post, pongo2.Context{"date": date, "categories": []interface{}{"go", "web"}}, "/go/web/welcome-to-jedie/"},
+		{"/:categories/:title/", post, pongo2.Context{"date": date, "categories": "go web"}, "/go/web/welcome-to-jedie/"},
+		{"/:short_year/:i_month/:i_day/:hour:minute:second/:title", post, pongo2.Context{"date": date}, "/13/11/23/040506/welcome-to-jedie.html"},
+		{"/:year/w:week/:slug:output_ext", post, pongo2.Context{"date": date, "slug": "Hello World!"}, "/2013/w47/hello-world.html"},
+		{"/:title:output_ext", "/src/_posts/2013-11-23-app.js", pongo2.Context{"date": date}, "/app.js"},
+		{"/:unknown/:title.html", post, pongo2.Context{"date": date}, "/:unknown/welcome-to-jedie.html"},
+		{defaultPagePermalink, "/src/index.md", pongo2.Context{}, "/index.html"},
+		{defaultPagePermalink, "/src/blog/about.html", pongo2.Context{}, "/blog/about.html"},
+		{defaultPagePermalink, "/src/css/site.css", pongo2.Context{}, "/css/site.css"},
+		{"/:path/:basename/", "/src/blog/about.md", pongo2.Context{}, "/blog/about/"},
+	}
+
+	for _, test := range tests {
+		actual := cfg.toPermalink(test.pattern, test.from, test.vars)
+		if actual != test.out {
+			t.Errorf("%s: expected %v actual %v", test.pattern, test.out, actual)
+		}
+	}
+}
+
+func TestPermalinkOutput(t *testing.T) {
+	cfg := config{
+		Source:      "/src",
+		Destination: "/src/_site",
+		Posts:       "/src/_posts",
+		Baseurl:     "http://example.com/blog",
+		Permalink:   permalinkStyle("pretty"),
+		Collections: map[string]collection{
+			"pages": {Permalink: "/:path/:basename/"},
+		},
+		loc: time.UTC,
+	}
+	tests := []struct {
+		from string
+		vars pongo2.Context
+		url  string
+		out  string
+	}{
+		{"/src/_posts/2013-11-23-welcome.md", pongo2.Context{}, "http://example.com/blog/2013/11/23/welcome/", "/src/_site/2013/11/23/welcome/index.html"},
+		{"/src/_posts/2013-11-23-welcome.md", pongo2.Context{"permalink": "/about/:title.html"}, "http://example.com/blog/about/welcome.html", "/src/_site/about/welcome.html"},
+		{"/src/about.md", pongo2.Context{}, "http://example.com/blog/about/", "/src/_site/about/index.html"},
+	}
+
+	for _, test := range tests {
+		var url, out string
+		if cfg.isPost(test.from) {
+			url, out = cfg.toPostURL(test.from, test.vars), cfg.toPost(test.from, test.vars)
+		} else {
+			url, out = cfg.toPageURL(test.from, test.vars), cfg.toPage(test.from, test.vars)
+		}
+		if url != test.url {
+			t.Errorf("%s: expected %v actual %v", test.from, test.url, url)
+		}
+		if out != test.out {
+			t.Errorf("%s: expected %v actual %v", test.from, test.out, out)
+		}
+	}
+}
+
+func TestCheckOutputs(t *testing.T) {
+	cfg := config{
+		Source:      "/src",
+		Destination: "/src/_site",
+		Posts:       "/src/_posts",
+		Permalink:   permalinkStyle("none"),
+		loc:         time.UTC,
+	}
+	posts := []pongo2.Context{
+		{"path": "/src/_posts/2013-11-23-welcome.md", "url": "/welcome.html"},
+		{"path": "/src/_posts/2013-11-24-hello.md", "url": "/hello.html"},
+	}
+	pages := []pongo2.Context{
+		{"path": "/src/index.html", "url": "/index.html"},
+		{"path": "/src/about.md", "url": "/about.html"},
+	}
+	if err := cfg.checkOutputs(posts, pages); err != nil {
+		t.Fatal(err)
+	}
+
+	pages = append(pages, pongo2.Context{"path": "/src/welcome.html", "url": "/welcome.html"})
+	err := cfg.checkOutputs(posts, pages)
+	if err == nil {
+		t.Fatal("Should be failed")
+	}
+	for _, s := range []string{"/src/_posts/2013-11-23-welcome.md", "/src/welcome.html"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Fatalf("%s is not reported: %v", s, err)
+		}
+	}
+}
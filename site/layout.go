@@ -0,0 +1,135 @@
+package site
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/flosch/pongo2"
+)
+
+// blockTag matches the tags of a block section in content of a page, which
+// fills the block of the same name in the layout:
+//
+//	{% block sidebar %}...{% endblock %}
+var blockTag = regexp.MustCompile(`{%-?\s*(?:block\s+(\w+)|endblock(?:\s+\w+)?)\s*-?%}`)
+
+// extendsTag matches the extends tag of a layout.
+var extendsTag = regexp.MustCompile(`{%-?\s*extends\s+["']([^"']+)["']\s*-?%}`)
+
+// blockVar is the prefix of the variables holding the blocks of a page in
+// the template which fills the blocks of a layout.
+const blockVar = "__block_"
+
+// extractBlocks removes the block sections from content and returns them by
+// name. The blocks nested in a section are kept in it, and also returned by
+// their names, so that they fill the blocks of the layout as well.
+func extractBlocks(content string) (string, map[string]string) {
+	type open struct {
+		name       string
+		start, end int
+	}
+	blocks := map[string]string{}
+	var stack []open
+	var b strings.Builder
+	last := 0
+	for _, m := range blockTag.FindAllStringSubmatchIndex(content, -1) {
+		if m[2] >= 0 {
+			stack = append(stack, open{name: content[m[2]:m[3]], start: m[0], end: m[1]})
+			continue
+		}
+		if len(stack) == 0 {
+			continue
+		}
+		o := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		blocks[o.name] = content[o.end:m[0]]
+		if len(stack) == 0 {
+			b.WriteString(content[last:o.start])
+			last = m[1]
+		}
+	}
+	b.WriteString(content[last:])
+	return b.String(), blocks
+}
+
+// frontMatterBlocks returns the blocks given with blocks in front matter.
+func frontMatterBlocks(pageVars pongo2.Context) map[string]string {
+	blocks := map[string]string{}
+	switch v := pageVars["blocks"].(type) {
+	case map[interface{}]interface{}:
+		for k, b := range v {
+			blocks[str(k)] = str(b)
+		}
+	case map[string]interface{}:
+		for k, b := range v {
+			blocks[k] = str(b)
+		}
+	}
+	return blocks
+}
+
+// layoutWithBlocks returns a template which extends the layout and fills its
+// blocks with the blocks of the page. The blocks are passed as safe values
+// by blockVars since they are rendered already.
+func layoutWithBlocks(path string, blocks pongo2.Context) string {
+	var names []string
+	for name := range blocks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	fmt.Fprintf(&b, "{%% extends %q %%}", path)
+	for _, name := range names {
+		fmt.Fprintf(&b, "{%% block %s %%}{{ %s%s }}{%% endblock %%}", name, blockVar, name)
+	}
+	return b.String()
+}
+
+func blockVars(blocks pongo2.Context) pongo2.Context {
+	vars := pongo2.Context{}
+	for name, b := range blocks {
+		vars[blockVar+name] = pongo2.AsSafeValue(str(b))
+	}
+	return vars
+}
+
+// checkExtends returns an error if the layout extends itself through the
+// chain of extends tags, which pongo2 would parse forever. The result is
+// kept for the build.
+func (cfg *config) checkExtends(path string) error {
+	if err, ok := cfg.extends[path]; ok {
+		return err
+	}
+	err := cfg.walkExtends(path)
+	if cfg.extends == nil {
+		cfg.extends = map[string]error{}
+	}
+	cfg.extends[path] = err
+	return err
+}
+
+// walkExtends follows the chain of extends tags from the layout.
+func (cfg *config) walkExtends(path string) error {
+	loader := &siteLoader{cfg: cfg}
+	chain := []string{path}
+	seen := map[string]bool{path: true}
+	for {
+		content, err := cfg.parseFile(path, pongo2.Context{})
+		if err != nil {
+			// The template engine reports it.
+			return nil
+		}
+		m := extendsTag.FindStringSubmatch(content)
+		if m == nil {
+			return nil
+		}
+		path = loader.Abs("", m[1])
+		chain = append(chain, path)
+		if seen[path] {
+			return fmt.Errorf("layout cycle: %s", strings.Join(chain, " extends "))
+		}
+		seen[path] = true
+	}
+}
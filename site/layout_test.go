@@ -0,0 +1,139 @@
+package site
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flosch/pongo2"
+)
+
+func TestLayoutBlocks(t *testing.T) {
+	dir, cfg := makeSite("name: jedie", map[string]string{
+		"_layouts/base.html":    "<head>{% block head %}{% endblock %}</head><main>{{ content }}</main><aside>{% block sidebar %}default{% endblock %}</aside>",
+		"_layouts/default.html": "---\n---\n{% extends \"base.html\" %}{% block head %}<title>{{ page.title }}</title>{% endblock %}",
+		"_layouts/self.html":    "---\nlayout: self\n---\n{{ content }}",
+		"_layouts/first.html":   "---\nlayout: second\n---\n{{ content }}",
+		"_layouts/second.html":  "---\nlayout: first\n---\n{{ content }}",
+		"_layouts/loop.html":    "{% extends \"loop2.html\" %}",
+		"_layouts/loop2.html":   "{% extends \"loop.html\" %}",
+		"_layouts/nested.html":  "{% block main %}[{% block inner %}inner{% endblock %}]{% endblock %}|{% block foot %}foot{% endblock %}",
+	})
+	defer os.RemoveAll(dir)
+	cfg.vars["site"] = pongo2.Context{"name": cfg.Name}
+
+	tests := []struct {
+		name string
+		in   string
+		out  string
+		err  string
+	}{
+		{
+			name: "plain.html",
+			in:   "---\ntitle: Plain\nlayout: default\n---\nhello",
+			out:  "<head><title>Plain</title></head><main>hello</main><aside>default</aside>",
+		},
+		{
+			name: "matter.html",
+			in:   "---\ntitle: Matter\nlayout: default\nblocks:\n  sidebar: <b>side</b>\n---\nhello",
+			out:  "<head><title>Matter</title></head><main>hello</main><aside><b>side</b></aside>",
+		},
+		{
+			name: "section.md",
+			in:   "---\ntitle: Section\nlayout: default\n---\nhello\n{% block sidebar %}*side* of {{ page.title }}{% endblock %}",
+			out:  "<head><title>Section</title></head><main><p>hello</p>\n</main><aside><p><em>side</em> of Section</p>\n</aside>",
+		},
+		{
+			name: "nested.html",
+			in:   "---\nlayout: nested\n---\n{% block main %}<{% block inner %}mine{% endblock inner %}>{% endblock main %}{% block foot %}end{% endblock %}",
+			out:  "<mine>|end",
+		},
+		{
+			name: "self.html",
+			in:   "---\nlayout: self\n---\nhello",
+			err:  "layout cycle: self -> self",
+		},
+		{
+			name: "chain.html",
+			in:   "---\nlayout: first\n---\nhello",
+			err:  "layout cycle: first -> second -> first",
+		},
+		{
+			name: "extends.html",
+			in:   "---\nlayout: loop\n---\nhello",
+			err:  "loop.html extends " + filepath.ToSlash(dir) + "/_layouts/loop2.html extends " + filepath.ToSlash(dir) + "/_layouts/loop.html",
+		},
+	}
+	for _, test := range tests {
+		from := filepath.ToSlash(filepath.Join(dir, test.name))
+		to := filepath.Join(dir, "_site", test.name)
+		if err := ioutil.WriteFile(from, []byte(test.in), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := cfg.convertFile(context.Background(), from, to)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("%s: want error %q but got %v", test.name, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		b, err := ioutil.ReadFile(to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSpace(string(b)); got != test.out {
+			t.Errorf("%s: want %q but got %q", test.name, test.out, got)
+		}
+	}
+}
+
+func TestExtractBlocks(t *testing.T) {
+	tests := []struct {
+		in      string
+		content string
+		blocks  map[string]string
+	}{
+		{"a{% block x %}1{% endblock %}b", "ab", map[string]string{"x": "1"}},
+		{"{% block x %}1{% block y %}2{% endblock %}3{% endblock %}", "", map[string]string{"x": "1{% block y %}2{% endblock %}3", "y": "2"}},
+		{"{%- block x -%}1{%- endblock x -%}{% block y %}", "{% block y %}", map[string]string{"x": "1"}},
+		{"a{% endblock %}", "a{% endblock %}", map[string]string{}},
+	}
+	for _, test := range tests {
+		content, blocks := extractBlocks(test.in)
+		if content != test.content || !reflect.DeepEqual(blocks, test.blocks) {
+			t.Errorf("%q: want %q, %v but got %q, %v", test.in, test.content, test.blocks, content, blocks)
+		}
+	}
+}
+
+func TestCheckExtendsCache(t *testing.T) {
+	dir, cfg := makeSite("name: jedie", map[string]string{
+		"_layouts/a.html": "{% extends \"b.html\" %}",
+		"_layouts/b.html": "b",
+	})
+	defer os.RemoveAll(dir)
+
+	a := filepath.ToSlash(filepath.Join(dir, "_layouts", "a.html"))
+	if err := cfg.checkExtends(a); err != nil {
+		t.Fatal(err)
+	}
+	// The chain is read once in a build.
+	b := filepath.Join(dir, "_layouts", "b.html")
+	if err := ioutil.WriteFile(b, []byte("{% extends \"a.html\" %}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.checkExtends(a); err != nil {
+		t.Fatal(err)
+	}
+	cfg.extends = nil
+	if err := cfg.checkExtends(a); err == nil || !strings.Contains(err.Error(), "layout cycle") {
+		t.Fatalf("want a layout cycle but got %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package site
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/flosch/pongo2"
+	"github.com/osteele/liquid"
+	"github.com/osteele/liquid/render"
+)
+
+// includeParam matches the key=value parameters of the include tag.
+var includeParam = regexp.MustCompile(`([\w-]+)\s*=\s*("(?:[^"\\]|\\.)*"|'[^']*'|\S+)`)
+
+// liquidEngine renders the site with Liquid templates, as Jekyll does.
+type liquidEngine struct {
+	cfg    *config
+	engine *liquid.Engine
+	cache  map[string]*liquid.Template
+}
+
+func newLiquidEngine(cfg *config) *liquidEngine {
+	e := &liquidEngine{
+		cfg:    cfg,
+		engine: liquid.NewEngine(),
+		cache:  map[string]*liquid.Template{},
+	}
+	e.engine.RegisterFilter("xml_escape", xmlEscape)
+	e.engine.RegisterFilter("date_to_string", func(date time.Time) string {
+		return date.Format("2006/01/02 15:04:05")
+	})
+	e.engine.RegisterFilter("date_to_rfc822", func(date time.Time) string {
+		return date.Format(time.RFC822)
+	})
+	e.engine.RegisterTag("include", e.include)
+	e.engine.RegisterTag("include_relative", e.includeRelative)
+	e.engine.RegisterTag("post_url", liquidLinkTag(cfg.postURL))
+	e.engine.RegisterTag("link", liquidLinkTag(cfg.linkURL))
+	e.engine.RegisterTag("asset_url", liquidLinkTag(cfg.assetURL))
+	e.engine.RegisterFilter("asset_url", cfg.assetURL)
+	e.engine.RegisterTag("asset_integrity", liquidLinkTag(cfg.assetIntegrity))
+	e.engine.RegisterFilter("asset_integrity", cfg.assetIntegrity)
+	e.engine.RegisterTag("asset_tag", liquidLinkTag(cfg.assetTag))
+	e.engine.RegisterFilter("asset_tag", cfg.assetTag)
+	e.engine.RegisterTag("image", liquidImageTag(cfg))
+	registerLiquidFilters(cfg, e.engine)
+	return e
+}
+
+func (e *liquidEngine) renderString(src, content string, vars pongo2.Context) (string, error) {
+	tpl, err := e.engine.ParseTemplateLocation([]byte(content), src, 1)
+	if err != nil {
+		return "", err
+	}
+	return e.render(tpl, vars)
+}
+
+func (e *liquidEngine) renderFile(path string, vars pongo2.Context) (string, error) {
+	tpl, err := e.template(path)
+	if err != nil {
+		return "", err
+	}
+	return e.render(tpl, vars)
+}
+
+// renderLayout renders the layout. Liquid has no blocks, so layouts use the
+// blocks of the page as page.blocks.
+func (e *liquidEngine) renderLayout(path string, blocks, vars pongo2.Context) (string, error) {
+	return e.renderFile(path, vars)
+}
+
+func (e *liquidEngine) cleanCache() {
+	e.cache = map[string]*liquid.Template{}
+}
+
+func (e *liquidEngine) render(tpl *liquid.Template, vars map[string]interface{}) (string, error) {
+	output, err := tpl.RenderString(vars)
+	if err != nil {
+		return "", err
+	}
+	return output, nil
+}
+
+// template returns the parsed template of the file. The file is read through
+// the loader of the site, so it is looked up in the includes and layouts
+// directories and must not be outside of the site.
+func (e *liquidEngine) template(path string) (*liquid.Template, error) {
+	loader := &siteLoader{cfg: e.cfg}
+	path = loader.Abs("", path)
+	if tpl, ok := e.cache[path]; ok {
+		return tpl, nil
+	}
+	r, err := loader.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	tpl, serr := e.engine.ParseTemplateLocation(b, path, 1)
+	if serr != nil {
+		return nil, serr
+	}
+	e.cache[path] = tpl
+	return tpl, nil
+}
+
+// include implements the include tag of Jekyll:
+//
+//	{% include figure.html src="a.png" caption=page.title %}
+//
+// The parameters are available as include.* in the included file.
+func (e *liquidEngine) include(ctx render.Context) (string, error) {
+	return e.includeFile(ctx, false)
+}
+
+// includeRelative implements the include_relative tag of Jekyll, which looks
+// up the file from the directory of the current file.
+func (e *liquidEngine) includeRelative(ctx render.Context) (string, error) {
+	return e.includeFile(ctx, true)
+}
+
+func (e *liquidEngine) includeFile(ctx render.Context, relative bool) (string, error) {
+	depth, _ := ctx.Get(includeDepthKey).(int)
+	if depth >= maxIncludeDepth {
+		return "", ctx.Errorf("includes nested more than %d levels", maxIncludeDepth)
+	}
+
+	args, err := ctx.ExpandTagArg()
+	if err != nil {
+		return "", err
+	}
+	args = strings.TrimSpace(args)
+	name, rest := args, ""
+	if i := strings.IndexAny(args, " \t\n"); i >= 0 {
+		name, rest = args[:i], args[i:]
+	}
+	name = strings.Trim(name, `"'`)
+	if relative {
+		name = filepath.ToSlash(filepath.Join(filepath.Dir(ctx.SourceFile()), name))
+		if e.cfg.sourceRel(name) == "" {
+			return "", ctx.Errorf("%s: outside of the source directory", name)
+		}
+	}
+
+	params := map[string]interface{}{}
+	for _, m := range includeParam.FindAllStringSubmatch(rest, -1) {
+		v, err := ctx.EvaluateString(m[2])
+		if err != nil {
+			return "", err
+		}
+		params[m[1]] = v
+	}
+
+	tpl, err := e.template(name)
+	if err != nil {
+		return "", ctx.WrapError(err)
+	}
+	vars := map[string]interface{}{}
+	for k, v := range ctx.Bindings() {
+		vars[k] = v
+	}
+	vars["include"] = params
+	vars[includeDepthKey] = depth + 1
+	return e.render(tpl, vars)
+}
@@ -0,0 +1,191 @@
+package site
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Output is where a site is written. The names are slash separated paths
+// relative to the destination, such as "2013/11/23/hello/index.html".
+type Output interface {
+	WriteFile(name string, data []byte) error
+}
+
+// DirOutput returns the output writing the files in the directory dir.
+func DirOutput(dir string) Output {
+	return dirOutput(dir)
+}
+
+type dirOutput string
+
+func (dir dirOutput) WriteFile(name string, data []byte) error {
+	p := filepath.Join(string(dir), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, data, 0644)
+}
+
+// MemoryOutput is the output keeping the files in memory. It serves the files
+// over HTTP, so a site can be served without writing it to the disk.
+type MemoryOutput struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+}
+
+// NewMemoryOutput returns an empty MemoryOutput.
+func NewMemoryOutput() *MemoryOutput {
+	return &MemoryOutput{files: map[string][]byte{}}
+}
+
+// WriteFile implements Output.
+func (m *MemoryOutput) WriteFile(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[name] = append([]byte(nil), data...)
+	return nil
+}
+
+// ReadFile returns the content of the file name, and whether it is written.
+func (m *MemoryOutput) ReadFile(name string) ([]byte, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.files[name]
+	return b, ok
+}
+
+// Names returns the sorted names of the files written.
+func (m *MemoryOutput) Names() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.files))
+	for name := range m.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ServeHTTP serves the files written. The index.html of a directory is
+// served for the directory.
+func (m *MemoryOutput) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	b, ok := m.ReadFile(name)
+	if !ok {
+		if name != "" {
+			name += "/"
+		}
+		name += "index.html"
+		if b, ok = m.ReadFile(name); !ok {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	http.ServeContent(w, r, path.Base(name), time.Time{}, bytes.NewReader(b))
+}
+
+// ZipOutput is the output writing the files to a zip archive. Close must be
+// called after the build to finish the archive.
+type ZipOutput struct {
+	mu sync.Mutex
+	zw *zip.Writer
+}
+
+// NewZipOutput returns the output writing a zip archive to w.
+func NewZipOutput(w io.Writer) *ZipOutput {
+	return &ZipOutput{zw: zip.NewWriter(w)}
+}
+
+// WriteFile implements Output.
+func (z *ZipOutput) WriteFile(name string, data []byte) error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	f, err := z.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// Close finishes the archive. It does not close the underlying writer.
+func (z *ZipOutput) Close() error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.zw.Close()
+}
+
+// TarOutput is the output writing the files to a tar archive. Close must be
+// called after the build to finish the archive.
+type TarOutput struct {
+	mu sync.Mutex
+	tw *tar.Writer
+}
+
+// NewTarOutput returns the output writing a tar archive to w.
+func NewTarOutput(w io.Writer) *TarOutput {
+	return &TarOutput{tw: tar.NewWriter(w)}
+}
+
+// WriteFile implements Output.
+func (t *TarOutput) WriteFile(name string, data []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := t.tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = t.tw.Write(data)
+	return err
+}
+
+// Close finishes the archive. It does not close the underlying writer.
+func (t *TarOutput) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tw.Close()
+}
+
+// dest returns the output of the site.
+func (cfg *config) dest() Output {
+	if cfg.output == nil {
+		return DirOutput(cfg.Destination)
+	}
+	return cfg.output
+}
+
+// toDisk reports whether the site is written to the destination directory.
+func (cfg *config) toDisk() bool {
+	dir, ok := cfg.dest().(dirOutput)
+	return ok && filepath.ToSlash(string(dir)) == cfg.Destination
+}
+
+// writeOutput writes data to the path to in the destination, with its
+// compressed copies.
+func (cfg *config) writeOutput(to string, data []byte) error {
+	name := strings.TrimPrefix(filepath.ToSlash(to), cfg.Destination+"/")
+	if err := cfg.dest().WriteFile(name, data); err != nil {
+		return err
+	}
+	return cfg.writeCompressed(name, data)
+}
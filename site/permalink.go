@@ -0,0 +1,151 @@
+package site
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/flosch/pongo2"
+)
+
+// permalinkStyles maps the names of the built-in permalink styles to their
+// patterns.
+var permalinkStyles = map[string]string{
+	"date":    "/:categories/:year/:month/:day/:title:output_ext",
+	"pretty":  "/:categories/:year/:month/:day/:title/",
+	"ordinal": "/:categories/:year/:y_day/:title:output_ext",
+	"none":    "/:categories/:title:output_ext",
+}
+
+const defaultPagePermalink = "/:path/:basename:output_ext"
+
+var (
+	placeholder   = regexp.MustCompile(`:([a-z_]+)`)
+	emptySegments = regexp.MustCompile(`/{2,}`)
+)
+
+// collection holds the configuration of the posts or pages collection.
+type collection struct {
+	Permalink string `yaml:"permalink"`
+}
+
+func permalinkStyle(pattern string) string {
+	if style, ok := permalinkStyles[pattern]; ok {
+		return style
+	}
+	return pattern
+}
+
+func (cfg *config) postPermalink(pageVars pongo2.Context) string {
+	if v := str(pageVars["permalink"]); v != "" {
+		return v
+	}
+	if c, ok := cfg.Collections["posts"]; ok && c.Permalink != "" {
+		return permalinkStyle(c.Permalink)
+	}
+	return cfg.Permalink
+}
+
+func (cfg *config) pagePermalink(pageVars pongo2.Context) string {
+	if v := str(pageVars["permalink"]); v != "" {
+		return v
+	}
+	if c, ok := cfg.Collections["pages"]; ok && c.Permalink != "" {
+		return permalinkStyle(c.Permalink)
+	}
+	return defaultPagePermalink
+}
+
+// outputExt returns the extension of the file generated from the file.
+func (cfg *config) outputExt(from string) string {
+	if cfg.isMarkdown(from) {
+		return ".html"
+	}
+	if c := cfg.conversionOf(from); c != nil {
+		return "." + c.Ext
+	}
+	if cfg.isSass(from) {
+		return ".css"
+	}
+	return filepath.Ext(from)
+}
+
+// toPermalink expands the placeholders in pattern for the file, and returns
+// the URL path of the output relative to the site root. Empty segments are
+// collapsed, and the output extension is appended when the last segment has
+// neither an extension nor a trailing slash, so the URL and the path written
+// always agree.
+func (cfg *config) toPermalink(pattern, from string, pageVars pongo2.Context) string {
+	ext := filepath.Ext(from)
+	name := filepath.Base(from)
+	name = name[0 : len(name)-len(ext)]
+	title := name
+	if len(name) > 11 && datePrefix.MatchString(name) {
+		title = name[11:]
+	}
+	if v := str(pageVars["slug"]); v != "" {
+		title = v
+	}
+	dir := ""
+	if rel := cfg.sourceRel(from); rel != "" {
+		dir = path.Dir("/" + rel)
+	}
+	date, _ := cfg.toDate(from, pageVars)
+	_, week := date.ISOWeek()
+
+	values := map[string]string{
+		"categories": strings.Join(categoriesOf(pageVars), "/"),
+		"year":       fmt.Sprintf("%d", date.Year()),
+		"short_year": date.Format("06"),
+		"month":      fmt.Sprintf("%02d", date.Month()),
+		"i_month":    fmt.Sprintf("%d", date.Month()),
+		"day":        fmt.Sprintf("%02d", date.Day()),
+		"i_day":      fmt.Sprintf("%d", date.Day()),
+		"hour":       fmt.Sprintf("%02d", date.Hour()),
+		"minute":     fmt.Sprintf("%02d", date.Minute()),
+		"second":     fmt.Sprintf("%02d", date.Second()),
+		"y_day":      fmt.Sprintf("%03d", date.YearDay()),
+		"week":       fmt.Sprintf("%02d", week),
+		"title":      title,
+		"slug":       slugify(title),
+		"path":       dir,
+		"basename":   name,
+		"output_ext": cfg.outputExt(from),
+	}
+	permalink := placeholder.ReplaceAllStringFunc(pattern, func(s string) string {
+		if v, ok := values[s[1:]]; ok {
+			return v
+		}
+		return s
+	})
+	permalink = emptySegments.ReplaceAllString("/"+permalink, "/")
+	if !strings.HasSuffix(permalink, "/") && path.Ext(permalink) == "" {
+		permalink += values["output_ext"]
+	}
+	return permalink
+}
+
+var datePrefix = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}-`)
+
+// categoriesOf returns the categories of the page given as category and
+// categories front matter. categories may be a list or a space separated
+// string.
+func categoriesOf(pageVars pongo2.Context) []string {
+	var categories []string
+	if v := strings.TrimSpace(str(pageVars["category"])); v != "" {
+		categories = append(categories, v)
+	}
+	switch v := pageVars["categories"].(type) {
+	case string:
+		categories = append(categories, strings.Fields(v)...)
+	case []interface{}:
+		for _, c := range v {
+			if s := strings.TrimSpace(fmt.Sprint(c)); s != "" {
+				categories = append(categories, s)
+			}
+		}
+	}
+	return categories
+}
@@ -0,0 +1,158 @@
+package site
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/flosch/pongo2"
+)
+
+// related configures page.related_posts of the posts:
+//
+//	related:
+//	  limit: 5
+//	  tfidf: true
+//
+// The posts sharing more tags and categories come first. With TFIDF, the
+// similarity of the content by TF-IDF also counts, which relates the posts
+// without the tags in common. The ties are ordered by the date, newest
+// first, so the same posts always give the same related posts.
+type related struct {
+	Limit int  `yaml:"limit"`
+	TFIDF bool `yaml:"tfidf"`
+}
+
+// checkRelated checks the config of the related posts, and sets the
+// defaults.
+func (cfg *config) checkRelated() error {
+	if cfg.Related.Limit < 0 {
+		return fmt.Errorf("related: limit must not be negative")
+	}
+	if cfg.Related.Limit == 0 {
+		cfg.Related.Limit = 10
+	}
+	return nil
+}
+
+// termWeight is the weight of a term in the TF-IDF vector of a post.
+type termWeight struct {
+	term   string
+	weight float64
+}
+
+// tfidf returns the TF-IDF vectors of the documents, normalized and sorted by
+// the terms, so that the sums do not depend on the order of maps.
+func tfidf(docs []string) [][]termWeight {
+	counts := make([]map[string]int, len(docs))
+	df := map[string]int{}
+	for i, doc := range docs {
+		counts[i] = map[string]int{}
+		tokenize(doc, func(token string) {
+			if counts[i][token] == 0 {
+				df[token]++
+			}
+			counts[i][token]++
+		})
+	}
+	vectors := make([][]termWeight, len(docs))
+	for i, count := range counts {
+		terms := make([]string, 0, len(count))
+		for term := range count {
+			terms = append(terms, term)
+		}
+		sort.Strings(terms)
+		var norm float64
+		for _, term := range terms {
+			w := float64(count[term]) * math.Log(float64(len(docs))/float64(df[term]))
+			if w == 0 {
+				continue
+			}
+			vectors[i] = append(vectors[i], termWeight{term, w})
+			norm += w * w
+		}
+		norm = math.Sqrt(norm)
+		for j := range vectors[i] {
+			vectors[i][j].weight /= norm
+		}
+	}
+	return vectors
+}
+
+// cosine returns the cosine similarity of the normalized vectors.
+func cosine(a, b []termWeight) float64 {
+	var sum float64
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i].term < b[j].term:
+			i++
+		case a[i].term > b[j].term:
+			j++
+		default:
+			sum += a[i].weight * b[j].weight
+			i++
+			j++
+		}
+	}
+	return sum
+}
+
+// relatePosts sets related_posts of the posts, which are sorted newest
+// first.
+func (cfg *config) relatePosts(posts []pongo2.Context) {
+	cfg.related = map[string][]pongo2.Context{}
+	tags := make([]map[string]bool, len(posts))
+	for i, post := range posts {
+		tags[i] = map[string]bool{}
+		for _, key := range []string{"tags", "categories", "category"} {
+			for _, tag := range toStrings(post[key]) {
+				tags[i][tag] = true
+			}
+		}
+	}
+	var vectors [][]termWeight
+	if cfg.Related.TFIDF {
+		docs := make([]string, len(posts))
+		for i, post := range posts {
+			docs[i] = plainText(str(post["content"]))
+		}
+		vectors = tfidf(docs)
+	}
+
+	type candidate struct {
+		post  pongo2.Context
+		score float64
+	}
+	for i, post := range posts {
+		var candidates []candidate
+		for j, other := range posts {
+			if i == j {
+				continue
+			}
+			var score float64
+			for tag := range tags[j] {
+				if tags[i][tag] {
+					score++
+				}
+			}
+			if vectors != nil {
+				score += cosine(vectors[i], vectors[j])
+			}
+			if score > 0 {
+				candidates = append(candidates, candidate{other, score})
+			}
+		}
+		sort.SliceStable(candidates, func(a, b int) bool {
+			return candidates[a].score > candidates[b].score
+		})
+		if len(candidates) > cfg.Related.Limit {
+			candidates = candidates[:cfg.Related.Limit]
+		}
+		list := []pongo2.Context{}
+		for _, c := range candidates {
+			list = append(list, c.post)
+		}
+		post["related_posts"] = list
+		cfg.related[post["path"].(string)] = list
+	}
+}
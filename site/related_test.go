@@ -0,0 +1,67 @@
+package site
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRelatedPosts(t *testing.T) {
+	posts := map[string]string{
+		"a": "tags: [go, vim]\n---\nVim plugins written in Go",
+		"b": "tags: [go]\n---\nGo generics",
+		"c": "tags: [go, vim]\n---\nEditing Go with Vim",
+		"d": "---\nVim plugins in Lua",
+		"e": "category: misc\n---\nCooking pasta",
+	}
+	tests := []struct {
+		config string
+		want   map[string]string
+	}{
+		{
+			"related:\n  limit: 2",
+			map[string]string{"a": "C,B,", "b": "C,A,", "c": "A,B,", "d": "", "e": ""},
+		},
+		{
+			"template_engine: liquid\nrelated:\n  limit: 2",
+			map[string]string{"a": "C,B,", "b": "C,A,", "c": "A,B,", "d": "", "e": ""},
+		},
+		{
+			// B shares only go with A and C, which is weighed more in A.
+			"related:\n  tfidf: true",
+			map[string]string{"a": "C,B,D,", "b": "A,C,", "c": "A,B,D,", "d": "A,C,", "e": ""},
+		},
+	}
+	for _, test := range tests {
+		fsys := fstest.MapFS{
+			"_config.yml":        {Data: []byte(test.config)},
+			"_layouts/post.html": {Data: []byte("[{% for p in page.related_posts %}{{ p.title }},{% endfor %}]")},
+		}
+		for i, name := range []string{"a", "b", "c", "d", "e"} {
+			fsys["_posts/2024-01-0"+string(rune('1'+i))+"-"+name+".md"] = &fstest.MapFile{
+				Data: []byte("---\nlayout: post\ntitle: " + strings.ToUpper(name) + "\n" + posts[name] + "\n"),
+			}
+		}
+		out := NewMemoryOutput()
+		s := New(Options{FS: fsys, Output: out, Stdout: ioutil.Discard})
+		if err := s.Load(); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Build(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		for i, name := range []string{"a", "b", "c", "d", "e"} {
+			b, _ := out.ReadFile("2024/01/0" + string(rune('1'+i)) + "/" + name + ".html")
+			if got := strings.Trim(strings.TrimSpace(string(b)), "[]"); got != test.want[name] {
+				t.Errorf("%q: %s: want %q but got %q", test.config, name, test.want[name], got)
+			}
+		}
+	}
+
+	s := New(Options{FS: fstest.MapFS{"_config.yml": {Data: []byte("related:\n  limit: -1")}}, Output: NewMemoryOutput()})
+	if err := s.Load(); err == nil || !strings.HasPrefix(err.Error(), "related: ") {
+		t.Fatalf("want a related error but got %v", err)
+	}
+}
@@ -0,0 +1,1404 @@
+package site
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// sass configures the compilation of the Sass and SCSS files of the site.
+// The partials are imported from the directory of the file, then SassDir of
+// the source directory and the theme, then LoadPaths:
+//
+//	sass:
+//	  sass_dir: _sass
+//	  load_paths: [vendor/scss]
+//	  style: compressed
+//	  sourcemap: always
+type sass struct {
+	SassDir   string   `yaml:"sass_dir"`
+	LoadPaths []string `yaml:"load_paths"`
+	Style     string   `yaml:"style"`
+	Sourcemap string   `yaml:"sourcemap"`
+}
+
+// checkSass checks the config of Sass, and sets the defaults.
+func (cfg *config) checkSass() error {
+	if cfg.Sass.SassDir == "" {
+		cfg.Sass.SassDir = "_sass"
+	}
+	switch cfg.Sass.Style {
+	case "":
+		cfg.Sass.Style = "expanded"
+	case "expanded", "compressed":
+	default:
+		return fmt.Errorf("sass: unknown style %q", cfg.Sass.Style)
+	}
+	switch cfg.Sass.Sourcemap {
+	case "":
+		cfg.Sass.Sourcemap = "never"
+	case "always", "never":
+	default:
+		return fmt.Errorf("sass: unknown sourcemap %q", cfg.Sass.Sourcemap)
+	}
+	return nil
+}
+
+// isSass returns true if the file is compiled as Sass. A conversion of the
+// extension takes priority.
+func (cfg *config) isSass(from string) bool {
+	switch path.Ext(from) {
+	case ".scss", ".sass":
+		return cfg.conversionOf(from) == nil
+	}
+	return false
+}
+
+// sassDirs returns the directories where the Sass partials are imported
+// from, after the directory of the importing file.
+func (cfg *config) sassDirs() []string {
+	dirs := []string{path.Join(cfg.Source, cfg.Sass.SassDir)}
+	if path.IsAbs(cfg.Sass.SassDir) {
+		dirs[0] = cfg.abs(cfg.Sass.SassDir)
+	}
+	if cfg.themeDir != "" {
+		dirs = append(dirs, cfg.themePath("_sass"))
+	}
+	for _, p := range cfg.Sass.LoadPaths {
+		if path.IsAbs(p) {
+			dirs = append(dirs, cfg.abs(p))
+		} else {
+			dirs = append(dirs, path.Join(cfg.Source, p))
+		}
+	}
+	return dirs
+}
+
+// compileSass compiles the Sass or SCSS file src to the CSS file dst, and
+// writes the source map next to it if enabled.
+func (cfg *config) compileSass(ctx context.Context, src, dst string) error {
+	var content string
+	if page, ok := cfg.virtual[src]; ok {
+		content = page.content
+	} else {
+		b, err := cfg.readFile(src)
+		if err != nil {
+			return err
+		}
+		content = blankFrontMatter(string(b))
+	}
+	c := &sassCompiler{
+		cfg:        cfg,
+		compressed: cfg.Sass.Style == "compressed",
+		index:      map[string]int{},
+		used:       map[string]bool{},
+	}
+	css, w, err := c.compile(src, content)
+	if err != nil {
+		return err
+	}
+	if cfg.Sass.Sourcemap != "always" {
+		return cfg.writeFile(ctx, src, dst, css)
+	}
+	sm, err := w.sourceMap(path.Base(dst), c.sources(), c.contents)
+	if err != nil {
+		return err
+	}
+	css = append(css, "/*# sourceMappingURL="+path.Base(dst)+".map */\n"...)
+	if err := cfg.writeFile(ctx, src, dst, css); err != nil {
+		return err
+	}
+	return cfg.writeFile(ctx, src, dst+".map", sm)
+}
+
+// blankFrontMatter replaces the front matter with empty lines, so that the
+// lines of the errors and the source maps are the lines of the file.
+func blankFrontMatter(s string) string {
+	lines := strings.Split(s, "\n")
+	if len(lines) < 2 || strings.TrimRight(lines[0], "\r") != "---" {
+		return s
+	}
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimRight(lines[i], "\r") == "---" {
+			for j := 0; j <= i; j++ {
+				lines[j] = ""
+			}
+			return strings.Join(lines, "\n")
+		}
+	}
+	return s
+}
+
+// sassError is an error of the Sass file at the line.
+type sassError struct {
+	file string
+	line int
+	msg  string
+}
+
+func (e *sassError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.file, e.line, e.msg)
+}
+
+// sassStmt is a statement of SCSS: a declaration, a rule or an at-rule with
+// its block, or a comment.
+type sassStmt struct {
+	line     int
+	text     string
+	block    bool
+	children []*sassStmt
+	comment  bool
+}
+
+// sassParser splits SCSS into statements.
+type sassParser struct {
+	file string
+	src  string
+	pos  int
+	line int
+}
+
+func (p *sassParser) errorf(line int, format string, args ...interface{}) error {
+	return &sassError{file: p.file, line: line, msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *sassParser) advance(n int) {
+	p.line += strings.Count(p.src[p.pos:p.pos+n], "\n")
+	p.pos += n
+}
+
+// skipString returns the length of the string or the interpolation at the
+// position, or 0 if there is none.
+func (p *sassParser) skipString() (int, error) {
+	s := p.src[p.pos:]
+	switch {
+	case s[0] == '"' || s[0] == '\'':
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case s[0]:
+				return i + 1, nil
+			case '\n':
+				return 0, p.errorf(p.line, "unterminated string")
+			}
+		}
+		return 0, p.errorf(p.line, "unterminated string")
+	case strings.HasPrefix(s, "#{"):
+		if n := interpolationEnd(s); n > 0 {
+			return n, nil
+		}
+		return 0, p.errorf(p.line, "unterminated interpolation")
+	}
+	return 0, nil
+}
+
+// interpolationEnd returns the length of the interpolation #{...} at the
+// start of s, or 0 if it is not closed.
+func interpolationEnd(s string) int {
+	depth := 0
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
+
+// parseBlock parses the statements until the end of the block opened at the
+// line open, or of the file if open is 0.
+func (p *sassParser) parseBlock(open int) ([]*sassStmt, error) {
+	var stmts []*sassStmt
+	for {
+		for p.pos < len(p.src) && strings.IndexByte(" \t\r\n;", p.src[p.pos]) >= 0 {
+			p.advance(1)
+		}
+		if p.pos >= len(p.src) {
+			if open > 0 {
+				return nil, p.errorf(open, "expected }")
+			}
+			return stmts, nil
+		}
+		s := p.src[p.pos:]
+		switch {
+		case strings.HasPrefix(s, "//"):
+			n := strings.IndexByte(s, '\n')
+			if n < 0 {
+				n = len(s)
+			}
+			p.advance(n)
+			continue
+		case strings.HasPrefix(s, "/*"):
+			n := strings.Index(s[2:], "*/")
+			if n < 0 {
+				return nil, p.errorf(p.line, "unterminated comment")
+			}
+			stmts = append(stmts, &sassStmt{line: p.line, text: s[:n+4], comment: true})
+			p.advance(n + 4)
+			continue
+		case s[0] == '}':
+			if open == 0 {
+				return nil, p.errorf(p.line, "unexpected }")
+			}
+			p.advance(1)
+			return stmts, nil
+		}
+		stmt, err := p.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt)
+	}
+}
+
+// parseStatement parses the statement at the position, with its block.
+func (p *sassParser) parseStatement() (*sassStmt, error) {
+	stmt := &sassStmt{line: p.line}
+	var buf strings.Builder
+	depth := 0
+	for p.pos < len(p.src) {
+		n, err := p.skipString()
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			buf.WriteString(p.src[p.pos : p.pos+n])
+			p.advance(n)
+			continue
+		}
+		c := p.src[p.pos]
+		switch {
+		case c == '(' || c == '[':
+			depth++
+		case (c == ')' || c == ']') && depth > 0:
+			depth--
+		case depth == 0 && c == ';':
+			p.advance(1)
+			stmt.text = strings.TrimSpace(buf.String())
+			return stmt, nil
+		case depth == 0 && c == '}':
+			stmt.text = strings.TrimSpace(buf.String())
+			return stmt, nil
+		case depth == 0 && c == '{':
+			p.advance(1)
+			stmt.text = strings.TrimSpace(buf.String())
+			stmt.block = true
+			stmt.children, err = p.parseBlock(stmt.line)
+			return stmt, err
+		case depth == 0 && strings.HasPrefix(p.src[p.pos:], "//"):
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.advance(1)
+			}
+			continue
+		case strings.HasPrefix(p.src[p.pos:], "/*"):
+			n := strings.Index(p.src[p.pos+2:], "*/")
+			if n < 0 {
+				return nil, p.errorf(p.line, "unterminated comment")
+			}
+			p.advance(n + 4)
+			buf.WriteByte(' ')
+			continue
+		}
+		buf.WriteByte(c)
+		p.advance(1)
+	}
+	stmt.text = strings.TrimSpace(buf.String())
+	return stmt, nil
+}
+
+// sassToSCSS converts the indented syntax of Sass to SCSS, keeping the
+// lines.
+func sassToSCSS(src string) string {
+	lines := strings.Split(src, "\n")
+	var stack []int           // indents of the open blocks
+	prev, prevIndent := -1, 0 // the last statement, not ended yet
+	comment, commentIndent, commentEnd := "", 0, 0
+	closeComment := func() {
+		if comment == "/*" && !strings.Contains(lines[commentEnd], "*/") {
+			lines[commentEnd] += " */"
+		}
+		comment = ""
+	}
+	for i, l := range lines {
+		trimmed := strings.TrimSpace(l)
+		if trimmed == "" {
+			continue
+		}
+		indent := len(l) - len(strings.TrimLeft(l, " \t"))
+		if comment != "" {
+			if indent > commentIndent {
+				if comment == "//" {
+					lines[i] = "//" + l
+				}
+				commentEnd = i
+				continue
+			}
+			closeComment()
+		}
+		if strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "/*") {
+			comment, commentIndent, commentEnd = trimmed[:2], indent, i
+			continue
+		}
+		if prev >= 0 {
+			if indent > prevIndent {
+				lines[prev] += " {"
+				stack = append(stack, prevIndent)
+			} else {
+				lines[prev] += ";"
+			}
+		}
+		closing := ""
+		for len(stack) > 0 && indent <= stack[len(stack)-1] {
+			closing += "}"
+			stack = stack[:len(stack)-1]
+		}
+		switch {
+		case strings.HasPrefix(trimmed, "="):
+			trimmed = "@mixin " + strings.TrimSpace(trimmed[1:])
+		case strings.HasPrefix(trimmed, "+") && !strings.HasPrefix(trimmed, "+ "):
+			trimmed = "@include " + trimmed[1:]
+		}
+		lines[i] = closing + l[:indent] + trimmed
+		prev, prevIndent = i, indent
+	}
+	if comment != "" {
+		closeComment()
+	}
+	if prev >= 0 {
+		lines[prev] += ";"
+	}
+	return strings.Join(lines, "\n") + strings.Repeat("}", len(stack))
+}
+
+// sassCompiler compiles a Sass file and its imports.
+type sassCompiler struct {
+	cfg        *config
+	compressed bool
+	files      []string
+	contents   []string
+	index      map[string]int
+	used       map[string]bool
+	stack      []string
+	root       []*cssNode
+}
+
+// sassScope holds the variables and the mixins of a block.
+type sassScope struct {
+	vars   map[string]sassValue
+	mixins map[string]*sassMixin
+	parent *sassScope
+}
+
+func newSassScope(parent *sassScope) *sassScope {
+	return &sassScope{vars: map[string]sassValue{}, mixins: map[string]*sassMixin{}, parent: parent}
+}
+
+func (s *sassScope) lookup(name string) (sassValue, bool) {
+	for ; s != nil; s = s.parent {
+		if v, ok := s.vars[name]; ok {
+			return v, true
+		}
+	}
+	return sassValue{}, false
+}
+
+func (s *sassScope) mixin(name string) *sassMixin {
+	for ; s != nil; s = s.parent {
+		if m, ok := s.mixins[name]; ok {
+			return m
+		}
+	}
+	return nil
+}
+
+func (s *sassScope) global() *sassScope {
+	for s.parent != nil {
+		s = s.parent
+	}
+	return s
+}
+
+// sassMixin is a mixin defined with @mixin.
+type sassMixin struct {
+	params []sassParam
+	body   []*sassStmt
+	scope  *sassScope
+	file   string
+}
+
+type sassParam struct {
+	name string
+	def  string
+}
+
+// sassContent is the block passed to a mixin for @content.
+type sassContent struct {
+	body  []*sassStmt
+	scope *sassScope
+	file  string
+	outer *sassContent
+}
+
+// sassContext is where the statements of a block are evaluated and their
+// CSS is written.
+type sassContext struct {
+	file      string
+	scope     *sassScope
+	out       *[]*cssNode // where the rules are added
+	mediaOut  *[]*cssNode // where the current media query is
+	media     string
+	selectors []string // the selectors of the enclosing rule
+	rule      *cssNode // where the declarations are added
+	plain     bool     // the selectors are not nested, as in @keyframes
+	prefix    string   // the prefix of the nested properties
+	content   *sassContent
+}
+
+const (
+	cssRule = iota
+	cssAtRule
+	cssComment
+)
+
+// cssNode is a rule, an at-rule or a comment of the CSS output.
+type cssNode struct {
+	kind      int
+	selectors []string
+	text      string
+	block     bool
+	decls     []cssDecl
+	children  []*cssNode
+	file      int
+	line      int
+}
+
+// cssDecl is a declaration, or a comment if prop is empty.
+type cssDecl struct {
+	prop  string
+	value string
+	file  int
+	line  int
+}
+
+func (n *cssNode) empty() bool {
+	switch {
+	case n.kind == cssComment:
+		return false
+	case n.kind == cssAtRule && !n.block:
+		return false
+	case len(n.decls) > 0:
+		return false
+	}
+	for _, c := range n.children {
+		if !c.empty() {
+			return false
+		}
+	}
+	return true
+}
+
+// rel returns the path of the file shown in errors and source maps.
+func (c *sassCompiler) rel(file string) string {
+	if rel := c.cfg.sourceRel(file); rel != "" {
+		return rel
+	}
+	return file
+}
+
+func (c *sassCompiler) fileIndex(file string) int {
+	if i, ok := c.index[file]; ok {
+		return i
+	}
+	return -1
+}
+
+func (c *sassCompiler) sources() []string {
+	sources := make([]string, len(c.files))
+	for i, f := range c.files {
+		sources[i] = "/" + c.rel(f)
+	}
+	return sources
+}
+
+// parse parses the content of the file, converting the indented syntax.
+func (c *sassCompiler) parse(file, content string) ([]*sassStmt, error) {
+	if _, ok := c.index[file]; !ok {
+		c.index[file] = len(c.files)
+		c.files = append(c.files, file)
+		c.contents = append(c.contents, content)
+	}
+	if path.Ext(file) == ".sass" {
+		content = sassToSCSS(content)
+	}
+	p := &sassParser{file: c.rel(file), src: content, line: 1}
+	return p.parseBlock(0)
+}
+
+// compile compiles the file of the content, and returns the CSS and the
+// writer holding the mappings of the source map.
+func (c *sassCompiler) compile(file, content string) ([]byte, *cssWriter, error) {
+	stmts, err := c.parse(file, content)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.stack = []string{file}
+	ctx := sassContext{file: file, scope: newSassScope(nil), out: &c.root}
+	ctx.mediaOut = ctx.out
+	if err := c.evalBlock(ctx, stmts); err != nil {
+		return nil, nil, err
+	}
+	w := &cssWriter{compressed: c.compressed}
+	w.nodes(c.root, 0)
+	if c.compressed && w.buf.Len() > 0 {
+		w.write("\n")
+	}
+	return w.buf.Bytes(), w, nil
+}
+
+func (c *sassCompiler) evalBlock(ctx sassContext, stmts []*sassStmt) error {
+	for _, st := range stmts {
+		if err := c.evalStmt(ctx, st); err != nil {
+			if _, ok := err.(*sassError); ok {
+				return err
+			}
+			return &sassError{file: c.rel(ctx.file), line: st.line, msg: err.Error()}
+		}
+	}
+	return nil
+}
+
+var sassFlags = regexp.MustCompile(`\s*!(default|global)\s*$`)
+
+func (c *sassCompiler) evalStmt(ctx sassContext, st *sassStmt) error {
+	switch {
+	case st.comment:
+		if c.compressed && !strings.HasPrefix(st.text, "/*!") {
+			return nil
+		}
+		if ctx.rule != nil {
+			ctx.rule.decls = append(ctx.rule.decls, cssDecl{value: st.text, file: c.fileIndex(ctx.file), line: st.line})
+		} else {
+			*ctx.out = append(*ctx.out, &cssNode{kind: cssComment, text: st.text, file: c.fileIndex(ctx.file), line: st.line})
+		}
+		return nil
+	case strings.HasPrefix(st.text, "$"):
+		return c.assign(ctx, st)
+	case strings.HasPrefix(st.text, "@"):
+		return c.atRule(ctx, st)
+	case st.block && strings.HasSuffix(st.text, ":"):
+		prop, err := c.interpolate(ctx, strings.TrimSpace(strings.TrimSuffix(st.text, ":")))
+		if err != nil {
+			return err
+		}
+		child := ctx
+		child.prefix = ctx.prefix + prop + "-"
+		return c.evalBlock(child, st.children)
+	case st.block:
+		return c.rule(ctx, st)
+	}
+	return c.declaration(ctx, st)
+}
+
+// assign evaluates a variable assignment: $name: value [!default] [!global].
+func (c *sassCompiler) assign(ctx sassContext, st *sassStmt) error {
+	i := strings.IndexByte(st.text, ':')
+	if i < 0 {
+		return fmt.Errorf("expected \":\" after %s", st.text)
+	}
+	name := strings.TrimSpace(st.text[1:i])
+	expr := st.text[i+1:]
+	isDefault, isGlobal := false, false
+	for {
+		m := sassFlags.FindStringSubmatch(expr)
+		if m == nil {
+			break
+		}
+		isDefault = isDefault || m[1] == "default"
+		isGlobal = isGlobal || m[1] == "global"
+		expr = expr[:len(expr)-len(m[0])]
+	}
+	if isDefault {
+		if v, ok := ctx.scope.lookup(name); ok && v.kind != sassNull {
+			return nil
+		}
+	}
+	v, err := c.eval(ctx, expr)
+	if err != nil {
+		return err
+	}
+	scope := ctx.scope
+	if isGlobal {
+		scope = scope.global()
+	}
+	scope.vars[name] = v
+	return nil
+}
+
+// declaration evaluates a declaration of a property.
+func (c *sassCompiler) declaration(ctx sassContext, st *sassStmt) error {
+	i := strings.IndexByte(st.text, ':')
+	if i <= 0 {
+		return fmt.Errorf("expected a declaration but got %q", st.text)
+	}
+	if ctx.rule == nil {
+		return fmt.Errorf("declarations may only be used within style rules")
+	}
+	prop, err := c.interpolate(ctx, strings.TrimSpace(st.text[:i]))
+	if err != nil {
+		return err
+	}
+	prop = ctx.prefix + prop
+	expr := strings.TrimSpace(st.text[i+1:])
+	var value string
+	if strings.HasPrefix(prop, "--") {
+		// Custom properties are kept as they are.
+		if value, err = c.interpolate(ctx, expr); err != nil {
+			return err
+		}
+	} else {
+		v, err := c.eval(ctx, expr)
+		if err != nil {
+			return err
+		}
+		if v.kind == sassNull {
+			return nil
+		}
+		value = v.css(c.compressed)
+	}
+	ctx.rule.decls = append(ctx.rule.decls, cssDecl{prop: prop, value: value, file: c.fileIndex(ctx.file), line: st.line})
+	return nil
+}
+
+// rule evaluates a style rule, nesting its selectors in the selectors of the
+// enclosing rule.
+func (c *sassCompiler) rule(ctx sassContext, st *sassStmt) error {
+	text, err := c.interpolate(ctx, st.text)
+	if err != nil {
+		return err
+	}
+	var selectors []string
+	for _, s := range splitTopLevel(text, ',') {
+		s = strings.Join(strings.Fields(s), " ")
+		if s == "" {
+			continue
+		}
+		switch {
+		case ctx.plain || ctx.selectors == nil:
+			if strings.Contains(s, "&") {
+				return fmt.Errorf("top-level selectors may not contain the parent selector \"&\"")
+			}
+			selectors = append(selectors, s)
+		case strings.Contains(s, "&"):
+			for _, parent := range ctx.selectors {
+				selectors = append(selectors, strings.ReplaceAll(s, "&", parent))
+			}
+		default:
+			for _, parent := range ctx.selectors {
+				selectors = append(selectors, parent+" "+s)
+			}
+		}
+	}
+	if len(selectors) == 0 {
+		return fmt.Errorf("expected a selector")
+	}
+	node := &cssNode{kind: cssRule, selectors: selectors, file: c.fileIndex(ctx.file), line: st.line}
+	*ctx.out = append(*ctx.out, node)
+	child := ctx
+	child.scope = newSassScope(ctx.scope)
+	child.selectors = selectors
+	child.rule = node
+	child.plain = false
+	child.prefix = ""
+	return c.evalBlock(child, st.children)
+}
+
+// atRule evaluates an at-rule.
+func (c *sassCompiler) atRule(ctx sassContext, st *sassStmt) error {
+	name := st.text[1:]
+	prelude := ""
+	if i := strings.IndexAny(name, " \t\r\n(\"'"); i >= 0 {
+		name, prelude = name[:i], strings.TrimSpace(name[i:])
+	}
+	switch name {
+	case "import":
+		return c.importRule(ctx, st, prelude)
+	case "use", "forward":
+		args := splitTopLevel(prelude, ' ')
+		if len(args) == 0 {
+			return fmt.Errorf("expected a URL after @%s", name)
+		}
+		url, err := c.eval(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		if url.kind != sassString || strings.HasPrefix(url.str, "sass:") {
+			return nil
+		}
+		p, err := c.resolve(ctx.file, url.str)
+		if err != nil {
+			return err
+		}
+		if c.used[p] {
+			return nil
+		}
+		c.used[p] = true
+		return c.importFile(ctx, p)
+	case "mixin":
+		return c.defineMixin(ctx, st, prelude)
+	case "include":
+		return c.include(ctx, st, prelude)
+	case "content":
+		if ctx.content == nil {
+			return nil
+		}
+		child := ctx
+		child.scope = newSassScope(ctx.content.scope)
+		child.file = ctx.content.file
+		child.content = ctx.content.outer
+		return c.evalBlock(child, ctx.content.body)
+	case "debug", "warn":
+		v, err := c.eval(ctx, prelude)
+		if err != nil {
+			return err
+		}
+		c.cfg.warnf("%s:%d: %s", c.rel(ctx.file), st.line, v.text())
+		return nil
+	case "error":
+		v, err := c.eval(ctx, prelude)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%s", v.text())
+	case "if", "else", "each", "for", "while", "function", "return", "extend", "at-root":
+		return fmt.Errorf("@%s is not supported", name)
+	}
+
+	prelude, err := c.substitute(ctx, prelude)
+	if err != nil {
+		return err
+	}
+	if !st.block {
+		text := "@" + name
+		if prelude != "" {
+			text += " " + prelude
+		}
+		*ctx.out = append(*ctx.out, &cssNode{kind: cssAtRule, text: text, file: c.fileIndex(ctx.file), line: st.line})
+		return nil
+	}
+
+	switch name {
+	case "media", "supports":
+		// The rule is bubbled out of the enclosing rules, and the media
+		// queries are merged. The queries which cannot be merged are kept
+		// nested, and the rule which can never match is dropped.
+		out := ctx.out
+		query := prelude
+		if name == "media" && ctx.media != "" {
+			if merged, ok := mergeMedia(ctx.media, prelude); ok {
+				out = ctx.mediaOut
+				query = merged
+			}
+		}
+		node := &cssNode{kind: cssAtRule, text: "@" + name + " " + query, block: true, file: c.fileIndex(ctx.file), line: st.line}
+		if query != "" {
+			*out = append(*out, node)
+		}
+		child := ctx
+		child.scope = newSassScope(ctx.scope)
+		child.out = &node.children
+		child.mediaOut = out
+		child.media = ""
+		if name == "media" {
+			child.media = query
+		}
+		if ctx.rule != nil && !ctx.plain {
+			rule := &cssNode{kind: cssRule, selectors: ctx.selectors, file: c.fileIndex(ctx.file), line: st.line}
+			node.children = append(node.children, rule)
+			child.rule = rule
+		}
+		return c.evalBlock(child, st.children)
+	}
+
+	text := "@" + name
+	if prelude != "" {
+		text += " " + prelude
+	}
+	node := &cssNode{kind: cssAtRule, text: text, block: true, file: c.fileIndex(ctx.file), line: st.line}
+	*ctx.out = append(*ctx.out, node)
+	child := ctx
+	child.scope = newSassScope(ctx.scope)
+	child.out = &node.children
+	child.mediaOut = child.out
+	child.media = ""
+	child.selectors = nil
+	child.rule = nil
+	child.plain = true
+	child.prefix = ""
+	switch name {
+	case "font-face", "page", "counter-style", "property", "viewport":
+		// The at-rule holds declarations.
+		child.rule = node
+	}
+	return c.evalBlock(child, st.children)
+}
+
+// mediaQuery is a media query such as "not screen and (color)".
+type mediaQuery struct {
+	modifier string // not or only
+	typ      string
+	features []string
+}
+
+// parseMediaQuery parses the media query q, and reports whether it is a type
+// and the features joined by and.
+func parseMediaQuery(q string) (mediaQuery, bool) {
+	var m mediaQuery
+	words := splitTopLevel(strings.TrimSpace(q), ' ')
+	if len(words) > 0 && !strings.HasPrefix(words[0], "(") {
+		if w := strings.ToLower(words[0]); w == "not" || w == "only" {
+			m.modifier = w
+			words = words[1:]
+		}
+		if len(words) == 0 || strings.HasPrefix(words[0], "(") {
+			return m, false
+		}
+		m.typ = words[0]
+		words = words[1:]
+		if len(words) > 0 {
+			if !strings.EqualFold(words[0], "and") {
+				return m, false
+			}
+			words = words[1:]
+		}
+	}
+	for i, w := range words {
+		if i%2 == 1 {
+			if !strings.EqualFold(w, "and") {
+				return m, false
+			}
+			continue
+		}
+		if !strings.HasPrefix(w, "(") {
+			return m, false
+		}
+		m.features = append(m.features, w)
+	}
+	if len(words) > 0 && len(words)%2 == 0 || m.typ == "" && len(m.features) == 0 {
+		return m, false
+	}
+	return m, true
+}
+
+func (m mediaQuery) String() string {
+	parts := m.features
+	if m.typ != "" {
+		parts = append([]string{strings.TrimSpace(m.modifier + " " + m.typ)}, parts...)
+	}
+	return strings.Join(parts, " and ")
+}
+
+// isAll reports whether the query matches all the media types.
+func (m mediaQuery) isAll() bool {
+	return m.typ == "" || strings.EqualFold(m.typ, "all")
+}
+
+// mergeMediaQuery returns the query matching both of the queries a and b.
+// It returns false for empty if no media match both, and false for ok if
+// the intersection cannot be written as a query.
+func mergeMediaQuery(a, b mediaQuery) (merged mediaQuery, empty, ok bool) {
+	features := append(append([]string{}, a.features...), b.features...)
+	switch {
+	case (a.modifier == "not") != (b.modifier == "not"):
+		neg, pos := a, b
+		if b.modifier == "not" {
+			neg, pos = b, a
+		}
+		if strings.EqualFold(a.typ, b.typ) {
+			for _, f := range neg.features {
+				found := false
+				for _, g := range pos.features {
+					found = found || f == g
+				}
+				if !found {
+					return merged, false, false
+				}
+			}
+			return merged, true, true
+		}
+		if a.isAll() || b.isAll() {
+			return merged, false, false
+		}
+		// not print and screen are screen.
+		return pos, false, true
+	case a.modifier == "not":
+		if !strings.EqualFold(a.typ, b.typ) {
+			return merged, false, false
+		}
+		if len(a.features) == 0 && len(b.features) == 0 {
+			return a, false, true
+		}
+		return merged, false, false
+	case a.isAll() && b.isAll():
+		merged = a
+		if a.typ == "" {
+			merged = b
+		}
+		if merged.modifier == "" {
+			merged.modifier = a.modifier
+		}
+	case a.isAll():
+		merged = b
+	case b.isAll():
+		merged = a
+	case !strings.EqualFold(a.typ, b.typ):
+		return merged, true, true
+	default:
+		merged = a
+		if merged.modifier == "" {
+			merged.modifier = b.modifier
+		}
+	}
+	merged.features = features
+	return merged, false, true
+}
+
+// mergeMedia returns the media query list of the rule nested in the query
+// list outer, such as "screen and (min-width: 10px)" for (min-width: 10px)
+// in screen. It returns false if the lists cannot be merged, and "" if no
+// media match.
+func mergeMedia(outer, inner string) (string, bool) {
+	var merged []string
+	for _, o := range splitTopLevel(outer, ',') {
+		oq, ok := parseMediaQuery(o)
+		if !ok {
+			return "", false
+		}
+		for _, i := range splitTopLevel(inner, ',') {
+			iq, ok := parseMediaQuery(i)
+			if !ok {
+				return "", false
+			}
+			m, empty, ok := mergeMediaQuery(oq, iq)
+			if !ok {
+				return "", false
+			}
+			if !empty {
+				merged = append(merged, m.String())
+			}
+		}
+	}
+	return strings.Join(merged, ", "), true
+}
+
+// importRule evaluates @import, importing the Sass files and keeping the
+// plain CSS imports.
+func (c *sassCompiler) importRule(ctx sassContext, st *sassStmt, prelude string) error {
+	for _, arg := range splitTopLevel(prelude, ',') {
+		arg = strings.TrimSpace(arg)
+		url, css := cssImport(arg)
+		if css {
+			*ctx.out = append(*ctx.out, &cssNode{kind: cssAtRule, text: "@import " + arg, file: c.fileIndex(ctx.file), line: st.line})
+			continue
+		}
+		p, err := c.resolve(ctx.file, url)
+		if err != nil {
+			return err
+		}
+		if err := c.importFile(ctx, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cssImport returns the URL of the import, and true if it is a plain CSS
+// import: a url(), a CSS file, a remote file, or an import with media
+// queries.
+func cssImport(arg string) (string, bool) {
+	if strings.HasPrefix(arg, "url(") {
+		return arg, true
+	}
+	url, rest := arg, ""
+	if arg != "" && (arg[0] == '"' || arg[0] == '\'') {
+		if end := strings.IndexByte(arg[1:], arg[0]); end >= 0 {
+			url, rest = arg[1:end+1], arg[end+2:]
+		}
+	}
+	return url, strings.TrimSpace(rest) != "" ||
+		strings.HasSuffix(url, ".css") ||
+		strings.HasPrefix(url, "http://") ||
+		strings.HasPrefix(url, "https://") ||
+		strings.HasPrefix(url, "//")
+}
+
+// resolve returns the path of the file imported from the file.
+func (c *sassCompiler) resolve(from, url string) (string, error) {
+	dir, base := path.Split(url)
+	var names []string
+	switch ext := path.Ext(base); ext {
+	case ".scss", ".sass", ".css":
+		names = []string{dir + "_" + base, dir + base}
+	default:
+		for _, ext := range []string{".scss", ".sass", ".css"} {
+			names = append(names, dir+"_"+base+ext, dir+base+ext)
+		}
+		names = append(names, path.Join(url, "_index.scss"), path.Join(url, "index.scss"), path.Join(url, "_index.sass"), path.Join(url, "index.sass"))
+	}
+	for _, d := range append([]string{path.Dir(from)}, c.cfg.sassDirs()...) {
+		for _, name := range names {
+			p := path.Join(d, name)
+			if fi, err := c.cfg.stat(p); err == nil && !fi.IsDir() {
+				return p, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("cannot find %q to import", url)
+}
+
+// importFile evaluates the file in the context.
+func (c *sassCompiler) importFile(ctx sassContext, p string) error {
+	for _, f := range c.stack {
+		if f == p {
+			return fmt.Errorf("%s imports itself", c.rel(p))
+		}
+	}
+	b, err := c.cfg.readFile(p)
+	if err != nil {
+		return err
+	}
+	stmts, err := c.parse(p, string(b))
+	if err != nil {
+		return err
+	}
+	c.stack = append(c.stack, p)
+	defer func() { c.stack = c.stack[:len(c.stack)-1] }()
+	child := ctx
+	child.file = p
+	return c.evalBlock(child, stmts)
+}
+
+// defineMixin evaluates @mixin name($param, $param: default).
+func (c *sassCompiler) defineMixin(ctx sassContext, st *sassStmt, prelude string) error {
+	name, args := splitCall(prelude)
+	if name == "" || !st.block {
+		return fmt.Errorf("expected a mixin name and its block")
+	}
+	m := &sassMixin{body: st.children, scope: ctx.scope, file: ctx.file}
+	for _, arg := range splitTopLevel(args, ',') {
+		arg = strings.TrimSpace(arg)
+		if arg == "" {
+			continue
+		}
+		p := sassParam{name: arg}
+		if i := strings.IndexByte(arg, ':'); i >= 0 {
+			p = sassParam{name: strings.TrimSpace(arg[:i]), def: strings.TrimSpace(arg[i+1:])}
+		}
+		if !strings.HasPrefix(p.name, "$") {
+			return fmt.Errorf("expected a parameter but got %q", arg)
+		}
+		p.name = p.name[1:]
+		m.params = append(m.params, p)
+	}
+	ctx.scope.mixins[name] = m
+	return nil
+}
+
+var sassKeywordArg = regexp.MustCompile(`^\$([\w-]+)\s*:`)
+
+// include evaluates @include name(args) with its content block.
+func (c *sassCompiler) include(ctx sassContext, st *sassStmt, prelude string) error {
+	name, args := splitCall(prelude)
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+	m := ctx.scope.mixin(name)
+	if m == nil {
+		return fmt.Errorf("undefined mixin %s", name)
+	}
+	scope := newSassScope(m.scope)
+	n := 0
+	for _, arg := range splitTopLevel(args, ',') {
+		arg = strings.TrimSpace(arg)
+		if arg == "" {
+			continue
+		}
+		if k := sassKeywordArg.FindStringSubmatch(arg); k != nil {
+			v, err := c.eval(ctx, arg[len(k[0]):])
+			if err != nil {
+				return err
+			}
+			found := false
+			for _, p := range m.params {
+				found = found || p.name == k[1]
+			}
+			if !found {
+				return fmt.Errorf("mixin %s has no parameter $%s", name, k[1])
+			}
+			scope.vars[k[1]] = v
+			continue
+		}
+		if n >= len(m.params) {
+			return fmt.Errorf("mixin %s takes %d arguments", name, len(m.params))
+		}
+		v, err := c.eval(ctx, arg)
+		if err != nil {
+			return err
+		}
+		scope.vars[m.params[n].name] = v
+		n++
+	}
+	body := ctx
+	body.scope = scope
+	body.file = m.file
+	for _, p := range m.params {
+		if _, ok := scope.vars[p.name]; ok {
+			continue
+		}
+		if p.def == "" {
+			return fmt.Errorf("missing argument $%s of mixin %s", p.name, name)
+		}
+		v, err := c.eval(body, p.def)
+		if err != nil {
+			return err
+		}
+		scope.vars[p.name] = v
+	}
+	body.content = nil
+	if st.block {
+		body.content = &sassContent{body: st.children, scope: ctx.scope, file: ctx.file, outer: ctx.content}
+	}
+	body.scope = newSassScope(scope)
+	return c.evalBlock(body, m.body)
+}
+
+// splitCall splits name(args) into the name and the arguments.
+func splitCall(s string) (string, string) {
+	i := strings.IndexByte(s, '(')
+	if i < 0 {
+		return strings.TrimSpace(s), ""
+	}
+	j := strings.LastIndexByte(s, ')')
+	if j < i {
+		j = len(s)
+	}
+	return strings.TrimSpace(s[:i]), s[i+1 : j]
+}
+
+// splitTopLevel splits s by sep outside of parentheses and strings.
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	depth := 0
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		case depth == 0 && (c == sep || sep == ' ' && (c == '\t' || c == '\n')):
+			if sep != ' ' || i > start {
+				parts = append(parts, s[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(s) || sep != ' ' && len(parts) > 0 {
+		parts = append(parts, s[start:])
+	}
+	return parts
+}
+
+// cssWriter writes the CSS, and records the mappings of the lines to the
+// sources.
+type cssWriter struct {
+	buf        bytes.Buffer
+	compressed bool
+	line       int
+	col        int
+	mappings   []cssMapping
+}
+
+type cssMapping struct {
+	line, col int
+	file, src int
+}
+
+func (w *cssWriter) write(s string) {
+	w.buf.WriteString(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		w.line += strings.Count(s, "\n")
+		w.col = len(s) - i - 1
+	} else {
+		w.col += len(s)
+	}
+}
+
+func (w *cssWriter) mark(file, line int) {
+	if file >= 0 {
+		w.mappings = append(w.mappings, cssMapping{line: w.line, col: w.col, file: file, src: line - 1})
+	}
+}
+
+var compressCombinator = regexp.MustCompile(`\s*([>+~,])\s*`)
+
+func (w *cssWriter) nodes(nodes []*cssNode, depth int) {
+	first := true
+	for _, n := range nodes {
+		if n.empty() {
+			continue
+		}
+		if !first && !w.compressed && depth == 0 {
+			w.write("\n")
+		}
+		first = false
+		w.node(n, depth)
+	}
+}
+
+func (w *cssWriter) node(n *cssNode, depth int) {
+	indent := strings.Repeat("  ", depth)
+	if w.compressed {
+		indent = ""
+	}
+	w.write(indent)
+	w.mark(n.file, n.line)
+	switch {
+	case n.kind == cssComment:
+		w.write(n.text)
+		if !w.compressed {
+			w.write("\n")
+		}
+		return
+	case n.kind == cssAtRule && !n.block:
+		w.write(n.text + ";")
+		if !w.compressed {
+			w.write("\n")
+		}
+		return
+	case n.kind == cssRule && w.compressed:
+		var selectors []string
+		for _, s := range n.selectors {
+			selectors = append(selectors, compressCombinator.ReplaceAllString(s, "$1"))
+		}
+		w.write(strings.Join(selectors, ",") + "{")
+	case n.kind == cssRule:
+		w.write(strings.Join(n.selectors, ",\n"+indent) + " {\n")
+	case w.compressed:
+		w.write(n.text + "{")
+	default:
+		w.write(n.text + " {\n")
+	}
+	for i, d := range n.decls {
+		if w.compressed {
+			if i > 0 {
+				w.write(";")
+			}
+			w.mark(d.file, d.line)
+			if d.prop == "" {
+				w.write(d.value)
+			} else {
+				w.write(d.prop + ":" + d.value)
+			}
+			continue
+		}
+		w.write(indent + "  ")
+		w.mark(d.file, d.line)
+		if d.prop == "" {
+			w.write(d.value + "\n")
+		} else {
+			w.write(d.prop + ": " + d.value + ";\n")
+		}
+	}
+	w.nodes(n.children, depth+1)
+	if w.compressed {
+		w.write("}")
+	} else {
+		w.write(indent + "}\n")
+	}
+}
+
+const base64VLQ = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+func writeVLQ(buf *strings.Builder, v int) {
+	u := v << 1
+	if v < 0 {
+		u = -v<<1 | 1
+	}
+	for {
+		digit := u & 31
+		u >>= 5
+		if u > 0 {
+			digit |= 32
+		}
+		buf.WriteByte(base64VLQ[digit])
+		if u == 0 {
+			return
+		}
+	}
+}
+
+// sourceMap returns the source map of version 3 of the CSS written.
+func (w *cssWriter) sourceMap(file string, sources, contents []string) ([]byte, error) {
+	mappings := append([]cssMapping(nil), w.mappings...)
+	sort.SliceStable(mappings, func(i, j int) bool {
+		if mappings[i].line != mappings[j].line {
+			return mappings[i].line < mappings[j].line
+		}
+		return mappings[i].col < mappings[j].col
+	})
+	var buf strings.Builder
+	line, col, prevFile, prevSrc := 0, 0, 0, 0
+	for i, m := range mappings {
+		if i > 0 && m.line == line {
+			buf.WriteByte(',')
+		}
+		for ; line < m.line; line++ {
+			buf.WriteByte(';')
+			col = 0
+		}
+		writeVLQ(&buf, m.col-col)
+		writeVLQ(&buf, m.file-prevFile)
+		writeVLQ(&buf, m.src-prevSrc)
+		writeVLQ(&buf, 0)
+		col, prevFile, prevSrc = m.col, m.file, m.src
+	}
+	return json.Marshal(struct {
+		Version        int      `json:"version"`
+		File           string   `json:"file"`
+		Sources        []string `json:"sources"`
+		SourcesContent []string `json:"sourcesContent"`
+		Names          []string `json:"names"`
+		Mappings       string   `json:"mappings"`
+	}{3, file, sources, contents, []string{}, buf.String()})
+}
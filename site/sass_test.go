@@ -0,0 +1,175 @@
+package site
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func buildSass(config string, files map[string]string) (*MemoryOutput, error) {
+	fsys := fstest.MapFS{
+		"_config.yml":        {Data: []byte(config)},
+		"_posts":             {Mode: fs.ModeDir},
+		"_sass/_vars.scss":   {Data: []byte("$gap: 8px !default;\n$brand: #336699;\n")},
+		"_sass/_mixins.scss": {Data: []byte("@mixin box($pad: $gap) {\n  padding: $pad;\n  @content;\n}\n")},
+		"_sass/_bad.scss":    {Data: []byte("a {\n  color: $nope;\n}\n")},
+		"vendor/_grid.scss":  {Data: []byte(".grid { display: grid; }\n")},
+	}
+	for name, content := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+	out := NewMemoryOutput()
+	s := New(Options{FS: fsys, Output: out, Stdout: ioutil.Discard})
+	if err := s.Load(); err != nil {
+		return nil, err
+	}
+	return out, s.Build(context.Background())
+}
+
+func TestSass(t *testing.T) {
+	tests := []struct {
+		style string
+		src   string
+		want  string
+	}{
+		{"", "$c: red;\na { color: $c; }", "a {\n  color: red;\n}\n"},
+		{"", ".nav {\n  margin: 0;\n  a, b { x: 1 }\n  &__item { &:hover { y: 2 } }\n}",
+			".nav {\n  margin: 0;\n}\n\n.nav a,\n.nav b {\n  x: 1;\n}\n\n.nav__item:hover {\n  y: 2;\n}\n"},
+		{"", "@import \"vars\", \"mixins\";\na { @include box { border: 0 } }", "a {\n  padding: 8px;\n  border: 0;\n}\n"},
+		{"", "$gap: 2px;\n@import 'vars', 'mixins';\na { @include box($pad: $gap * 2); }", "a {\n  padding: 4px;\n}\n"},
+		{"", "@use 'sass:math';\n@use 'vars' as v;\na { w: math.div(10px, 4); m: v.$gap * 2 auto; f: 12px/1.5 serif; c: calc(100% - #{$gap}); n: -$gap; }",
+			"a {\n  w: 2.5px;\n  m: 16px auto;\n  f: 12px/1.5 serif;\n  c: calc(100% - 8px);\n  n: -8px;\n}\n"},
+		{"", "a { color: darken(#336699, 10%); background: rgba(#336699, .5); content: \"a\" + b; w: percentage(0.25); }",
+			"a {\n  color: #264d73;\n  background: rgba(51, 102, 153, 0.5);\n  content: \"ab\";\n  w: 25%;\n}\n"},
+		{"", "a {\n  @media (min-width: 10px) {\n    b { x: 1 }\n    @media print { y: 2 }\n  }\n}",
+			"@media (min-width: 10px) {\n  a b {\n    x: 1;\n  }\n}\n\n@media print and (min-width: 10px) {\n  a {\n    y: 2;\n  }\n}\n"},
+		{"", "@media print {\n  a { x: 1 }\n  @media screen { b { y: 2 } }\n}",
+			"@media print {\n  a {\n    x: 1;\n  }\n}\n"},
+		{"", "a { font: { family: x; size: 2px; } }", "a {\n  font-family: x;\n  font-size: 2px;\n}\n"},
+		{"", "@import 'grid';\n@import url(x.css);\n@keyframes k { from { o: 0 } }",
+			".grid {\n  display: grid;\n}\n\n@import url(x.css);\n\n@keyframes k {\n  from {\n    o: 0;\n  }\n}\n"},
+		{"compressed", "/* drop */\n/*! keep */\na > b, c { margin: 0.5px auto; }\n@media print { a { x: y } }",
+			"/*! keep */a>b,c{margin:.5px auto}@media print{a{x:y}}\n"},
+	}
+	for _, test := range tests {
+		out, err := buildSass("sass:\n  load_paths: [vendor]\n  style: "+test.style, map[string]string{
+			"css/site.scss": "---\n---\n" + test.src,
+		})
+		if err != nil {
+			t.Fatalf("%q: %v", test.src, err)
+		}
+		b, ok := out.ReadFile("css/site.css")
+		if !ok {
+			t.Fatalf("%q: want css/site.css but got %v", test.src, out.Names())
+		}
+		if got := string(b); got != test.want {
+			t.Errorf("%q: want %q but got %q", test.src, test.want, got)
+		}
+	}
+}
+
+func TestSassSyntax(t *testing.T) {
+	out, err := buildSass("", map[string]string{
+		"css/site.sass": "@import vars\n=m($x)\n  color: $x\n// a comment\n  of lines\n.a\n  +m(red)\n  .b\n    margin: $gap\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := out.ReadFile("css/site.css")
+	want := ".a {\n  color: red;\n}\n\n.a .b {\n  margin: 8px;\n}\n"
+	if got := string(b); got != want {
+		t.Fatalf("want %q but got %q", want, got)
+	}
+}
+
+func TestSassErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"@import 'bad';", "_sass/_bad.scss:2: undefined variable $nope"},
+		{"\n@import 'missing';", "css/site.scss:2: cannot find \"missing\" to import"},
+		{"a {\n  b: 1;\n", "css/site.scss:1: expected }"},
+		{"---\n---\na {\n  width: 1px + 2%;\n}", "css/site.scss:4: incompatible units px and %"},
+		{"color: red;", "css/site.scss:1: declarations may only be used within style rules"},
+		{"a {\n  @include nope;\n}", "css/site.scss:2: undefined mixin nope"},
+		{"a {\n  @extend b;\n}", "css/site.scss:2: @extend is not supported"},
+		{"$m: (small: 1px, large: 2px);", "css/site.scss:1: maps are not supported"},
+		{"a {\n  w: map-get($m, small);\n}", "css/site.scss:2: map-get() is not supported"},
+		{"a {\n  c: color.adjust(red, $alpha: -0.5);\n}", "css/site.scss:2: color.adjust() is not supported"},
+	}
+	for _, test := range tests {
+		_, err := buildSass("", map[string]string{"css/site.scss": test.src})
+		if err == nil || !strings.HasSuffix(err.Error(), test.want) {
+			t.Errorf("%q: want error %q but got %v", test.src, test.want, err)
+		}
+	}
+
+	for _, config := range []string{"sass:\n  style: nested", "sass:\n  sourcemap: sometimes"} {
+		if _, err := buildSass(config, nil); err == nil || !strings.HasPrefix(err.Error(), "sass: ") {
+			t.Errorf("%q: want a sass error but got %v", config, err)
+		}
+	}
+}
+
+func TestSassSourceMap(t *testing.T) {
+	out, err := buildSass("sass:\n  sourcemap: always", map[string]string{
+		"css/site.scss": "@import 'mixins';\n$gap: 1px;\na {\n  @include box;\n}\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := out.ReadFile("css/site.css")
+	want := "a {\n  padding: 1px;\n}\n/*# sourceMappingURL=site.css.map */\n"
+	if got := string(b); got != want {
+		t.Fatalf("want %q but got %q", want, got)
+	}
+	b, ok := out.ReadFile("css/site.css.map")
+	if !ok {
+		t.Fatalf("want the source map but got %v", out.Names())
+	}
+	var sm struct {
+		Version  int      `json:"version"`
+		File     string   `json:"file"`
+		Sources  []string `json:"sources"`
+		Mappings string   `json:"mappings"`
+	}
+	if err := json.Unmarshal(b, &sm); err != nil {
+		t.Fatal(err)
+	}
+	if sm.Version != 3 || sm.File != "site.css" || strings.Join(sm.Sources, " ") != "/css/site.scss /_sass/_mixins.scss" {
+		t.Fatalf("unexpected source map %s", b)
+	}
+	// a of line 3 of site.scss, and padding of line 2 of _mixins.scss.
+	if want := "AAEA;ECDA"; sm.Mappings != want {
+		t.Fatalf("want mappings %q but got %q", want, sm.Mappings)
+	}
+}
+
+func TestMergeMedia(t *testing.T) {
+	tests := []struct {
+		outer, inner string
+		want         string
+		ok           bool
+	}{
+		{"screen", "(min-width: 10px)", "screen and (min-width: 10px)", true},
+		{"(min-width: 10px)", "only screen and (color)", "only screen and (min-width: 10px) and (color)", true},
+		{"screen, print", "print", "print", true},
+		{"all", "print", "print", true},
+		{"screen", "print", "", true},
+		{"not print", "screen", "screen", true},
+		{"not screen", "screen and (color)", "", true},
+		{"not screen and (color)", "screen", "", false},
+		{"(min-width: 10px) or (color)", "print", "", false},
+	}
+	for _, test := range tests {
+		got, ok := mergeMedia(test.outer, test.inner)
+		if got != test.want || ok != test.ok {
+			t.Errorf("%q in %q: want %q, %v but got %q, %v", test.inner, test.outer, test.want, test.ok, got, ok)
+		}
+	}
+}
@@ -0,0 +1,919 @@
+package site
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	sassNull = iota
+	sassNumber
+	sassString
+	sassList
+)
+
+// sassValue is the value of a Sass expression.
+type sassValue struct {
+	kind   int
+	num    float64
+	unit   string
+	str    string
+	quoted bool
+	list   []sassValue
+	sep    string
+	// computed is true for the values of variables, functions, parentheses
+	// and operations, which are divided by "/" rather than separated.
+	computed bool
+}
+
+func sassNum(f float64, unit string) sassValue {
+	return sassValue{kind: sassNumber, num: f, unit: unit, computed: true}
+}
+
+func sassWord(s string) sassValue {
+	return sassValue{kind: sassString, str: s}
+}
+
+func formatSassNumber(f float64, compressed bool) string {
+	s := strconv.FormatFloat(math.Round(f*1e10)/1e10, 'f', -1, 64)
+	switch {
+	case s == "-0":
+		s = "0"
+	case compressed && strings.HasPrefix(s, "0."):
+		s = s[1:]
+	case compressed && strings.HasPrefix(s, "-0."):
+		s = "-" + s[2:]
+	}
+	return s
+}
+
+// css returns the value as written in CSS.
+func (v sassValue) css(compressed bool) string {
+	switch v.kind {
+	case sassNumber:
+		return formatSassNumber(v.num, compressed) + v.unit
+	case sassString:
+		if !v.quoted {
+			return v.str
+		}
+		if strings.Contains(v.str, `"`) && !strings.Contains(v.str, "'") {
+			return "'" + v.str + "'"
+		}
+		return `"` + strings.ReplaceAll(v.str, `"`, `\"`) + `"`
+	case sassList:
+		sep := v.sep
+		if compressed {
+			sep = strings.TrimSpace(sep)
+			if sep == "" {
+				sep = " "
+			}
+		}
+		var parts []string
+		for _, item := range v.list {
+			if item.kind != sassNull {
+				parts = append(parts, item.css(compressed))
+			}
+		}
+		return strings.Join(parts, sep)
+	}
+	return ""
+}
+
+// text returns the value with the quotes of the strings removed.
+func (v sassValue) text() string {
+	if v.kind == sassString {
+		return v.str
+	}
+	return v.css(false)
+}
+
+// eval evaluates the expression in the context.
+func (c *sassCompiler) eval(ctx sassContext, expr string) (sassValue, error) {
+	expr, err := c.interpolate(ctx, expr)
+	if err != nil {
+		return sassValue{}, err
+	}
+	toks, err := lexSass(expr)
+	if err != nil {
+		return sassValue{}, err
+	}
+	if len(toks) == 0 {
+		return sassValue{}, fmt.Errorf("expected an expression")
+	}
+	p := &sassExprParser{c: c, ctx: ctx, toks: toks}
+	v, err := p.parseList()
+	if err != nil {
+		return sassValue{}, err
+	}
+	if p.i < len(p.toks) {
+		return sassValue{}, fmt.Errorf("unexpected %q", p.toks[p.i].text)
+	}
+	return v, nil
+}
+
+// interpolate replaces #{expr} in s with the values of the expressions.
+func (c *sassCompiler) interpolate(ctx sassContext, s string) (string, error) {
+	if !strings.Contains(s, "#{") {
+		return s, nil
+	}
+	var buf strings.Builder
+	for {
+		i := strings.Index(s, "#{")
+		if i < 0 {
+			buf.WriteString(s)
+			return buf.String(), nil
+		}
+		n := interpolationEnd(s[i:])
+		if n == 0 {
+			return "", fmt.Errorf("unterminated interpolation")
+		}
+		v, err := c.eval(ctx, s[i+2:i+n-1])
+		if err != nil {
+			return "", err
+		}
+		buf.WriteString(s[:i])
+		buf.WriteString(v.text())
+		s = s[i+n:]
+	}
+}
+
+// substitute replaces the interpolations and the variables in s, which is
+// not evaluated as an expression, such as a media query.
+func (c *sassCompiler) substitute(ctx sassContext, s string) (string, error) {
+	s, err := c.interpolate(ctx, s)
+	if err != nil {
+		return "", err
+	}
+	var buf strings.Builder
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '$':
+			j := i + 1
+			for j < len(s) && isSassNameChar(s[j]) {
+				j++
+			}
+			if j > i+1 {
+				v, ok := ctx.scope.lookup(s[i+1 : j])
+				if !ok {
+					return "", fmt.Errorf("undefined variable %s", s[i:j])
+				}
+				buf.WriteString(v.css(c.compressed))
+				i = j - 1
+				continue
+			}
+		}
+		buf.WriteByte(ch)
+	}
+	return buf.String(), nil
+}
+
+func isSassNameChar(c byte) bool {
+	return c == '-' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func isSassNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80 || c == '\\'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+const (
+	tokNumber = iota
+	tokString
+	tokWord
+	tokVariable
+	tokFunction
+	tokRaw
+	tokOp
+	tokOpen
+	tokClose
+	tokComma
+)
+
+// sassToken is a token of a Sass expression.
+type sassToken struct {
+	kind   int
+	text   string
+	num    float64
+	unit   string
+	quoted bool
+	space  bool   // preceded by whitespace
+	module string // the namespace, such as math of math.div
+}
+
+// rawFunctions are the CSS functions whose arguments are not evaluated but
+// for the variables.
+var rawFunctions = map[string]bool{"calc": true, "var": true, "env": true, "url": true, "expression": true}
+
+func lexSass(s string) ([]sassToken, error) {
+	var toks []sassToken
+	space := false
+	module := ""
+	for i := 0; i < len(s); {
+		c := s[i]
+		var prev *sassToken
+		if len(toks) > 0 {
+			prev = &toks[len(toks)-1]
+		}
+		afterOperand := prev != nil && !space && (prev.kind == tokNumber || prev.kind == tokVariable || prev.kind == tokClose || prev.kind == tokWord || prev.kind == tokString)
+		next := byte(0)
+		if i+1 < len(s) {
+			next = s[i+1]
+		}
+		t := sassToken{space: space}
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			space = true
+			i++
+			continue
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(s) && s[j] != c {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			t.kind, t.text, t.quoted = tokString, s[i+1:j], true
+			i = j + 1
+		case isDigit(c) || c == '.' && isDigit(next) ||
+			(c == '-' || c == '+') && !afterOperand && (isDigit(next) || next == '.' && i+2 < len(s) && isDigit(s[i+2])):
+			j := i + 1
+			for j < len(s) && (isDigit(s[j]) || s[j] == '.' && j+1 < len(s) && isDigit(s[j+1])) {
+				j++
+			}
+			f, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q", s[i:j])
+			}
+			k := j
+			if k < len(s) && s[k] == '%' {
+				k++
+			} else {
+				for k < len(s) && (s[k] >= 'a' && s[k] <= 'z' || s[k] >= 'A' && s[k] <= 'Z') {
+					k++
+				}
+			}
+			t.kind, t.text, t.num, t.unit = tokNumber, s[i:k], f, s[j:k]
+			i = k
+		case c == '$':
+			j := i + 1
+			for j < len(s) && isSassNameChar(s[j]) {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("expected a variable name")
+			}
+			t.kind, t.text = tokVariable, s[i+1:j]
+			i = j
+		case isSassNameStart(c) || c == '-' && (isSassNameStart(next) || next == '-' || next == '$'):
+			if c == '-' && next == '$' {
+				t.kind, t.text = tokOp, "-"
+				i++
+				break
+			}
+			j := i + 1
+			for j < len(s) && (isSassNameChar(s[j]) || s[j] == '\\') {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j > len(s) {
+				j = len(s)
+			}
+			name := s[i:j]
+			// A namespace of a module, such as math.div or config.$width.
+			if j+1 < len(s) && s[j] == '.' && (s[j+1] == '$' || isSassNameStart(s[j+1])) {
+				module = name
+				i = j + 1
+				continue
+			}
+			if j < len(s) && s[j] == '(' {
+				if rawFunctions[strings.ToLower(name)] {
+					end := closingParen(s, j)
+					if end < 0 {
+						return nil, fmt.Errorf("expected \")\"")
+					}
+					t.kind, t.text = tokRaw, s[i:end+1]
+					i = end + 1
+					break
+				}
+				t.kind, t.text = tokFunction, name
+				i = j + 1
+				break
+			}
+			t.kind, t.text = tokWord, name
+			i = j
+		case c == '#':
+			j := i + 1
+			for j < len(s) && isSassNameChar(s[j]) {
+				j++
+			}
+			t.kind, t.text = tokWord, s[i:j]
+			i = j
+		case c == '!' && isSassNameStart(next):
+			j := i + 1
+			for j < len(s) && isSassNameChar(s[j]) {
+				j++
+			}
+			t.kind, t.text = tokWord, s[i:j]
+			i = j
+		case c == '(':
+			t.kind, t.text = tokOpen, "("
+			i++
+		case c == ')':
+			t.kind, t.text = tokClose, ")"
+			i++
+		case c == ',':
+			t.kind, t.text = tokComma, ","
+			i++
+		case c == '+' || c == '-' || c == '*' || c == '/' || c == '%':
+			t.kind, t.text = tokOp, string(c)
+			i++
+		default:
+			t.kind, t.text = tokWord, string(c)
+			i++
+		}
+		t.module = module
+		toks = append(toks, t)
+		space = false
+		module = ""
+	}
+	return toks, nil
+}
+
+// closingParen returns the index of the parenthesis closing the one at i.
+func closingParen(s string, i int) int {
+	depth := 0
+	var quote byte
+	for ; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// sassExprParser parses and evaluates the tokens of an expression.
+type sassExprParser struct {
+	c     *sassCompiler
+	ctx   sassContext
+	toks  []sassToken
+	i     int
+	paren int
+}
+
+func (p *sassExprParser) peek() *sassToken {
+	if p.i < len(p.toks) {
+		return &p.toks[p.i]
+	}
+	return nil
+}
+
+// parseList parses a list separated by commas.
+func (p *sassExprParser) parseList() (sassValue, error) {
+	var items []sassValue
+	for {
+		v, err := p.parseSpaceList()
+		if err != nil {
+			return sassValue{}, err
+		}
+		items = append(items, v)
+		if t := p.peek(); t == nil || t.kind != tokComma {
+			break
+		}
+		p.i++
+		if t := p.peek(); t == nil || t.kind == tokClose {
+			break
+		}
+	}
+	if len(items) == 1 {
+		return items[0], nil
+	}
+	return sassValue{kind: sassList, list: items, sep: ", "}, nil
+}
+
+// parseSpaceList parses a list separated by spaces. The values which are
+// not separated are joined, such as "a" and ":" of "a:b".
+func (p *sassExprParser) parseSpaceList() (sassValue, error) {
+	var items []sassValue
+	for {
+		t := p.peek()
+		if t == nil || t.kind == tokComma || t.kind == tokClose {
+			break
+		}
+		space := t.space
+		v, err := p.parseSum()
+		if err != nil {
+			return sassValue{}, err
+		}
+		if len(items) > 0 && !space {
+			last := items[len(items)-1]
+			items[len(items)-1] = sassWord(last.css(p.c.compressed) + v.css(p.c.compressed))
+			continue
+		}
+		items = append(items, v)
+	}
+	switch len(items) {
+	case 0:
+		return sassValue{}, fmt.Errorf("expected an expression")
+	case 1:
+		return items[0], nil
+	}
+	return sassValue{kind: sassList, list: items, sep: " "}, nil
+}
+
+// binary returns the operator at the position if it is a binary operator of
+// the given ones. "-" and "+" are binary only with the same spacing on both
+// sides, so that "1px -2px" is a list.
+func (p *sassExprParser) binary(ops string) string {
+	t := p.peek()
+	if t == nil || t.kind != tokOp || !strings.Contains(ops, t.text) || p.i+1 >= len(p.toks) {
+		return ""
+	}
+	if (t.text == "-" || t.text == "+") && t.space != p.toks[p.i+1].space {
+		return ""
+	}
+	return t.text
+}
+
+func (p *sassExprParser) parseSum() (sassValue, error) {
+	v, err := p.parseProduct()
+	if err != nil {
+		return sassValue{}, err
+	}
+	for {
+		op := p.binary("+-")
+		if op == "" {
+			return v, nil
+		}
+		p.i++
+		r, err := p.parseProduct()
+		if err != nil {
+			return sassValue{}, err
+		}
+		if v, err = sassOperate(op, v, r, p.c.compressed); err != nil {
+			return sassValue{}, err
+		}
+	}
+}
+
+func (p *sassExprParser) parseProduct() (sassValue, error) {
+	v, err := p.parseUnary()
+	if err != nil {
+		return sassValue{}, err
+	}
+	for {
+		op := p.binary("*/%")
+		if op == "" {
+			return v, nil
+		}
+		p.i++
+		r, err := p.parseUnary()
+		if err != nil {
+			return sassValue{}, err
+		}
+		if op == "/" && p.paren == 0 && !v.computed && !r.computed {
+			// A slash separates the values in CSS, such as 12px/1.5.
+			v = sassWord(v.css(p.c.compressed) + "/" + r.css(p.c.compressed))
+			continue
+		}
+		if v, err = sassOperate(op, v, r, p.c.compressed); err != nil {
+			return sassValue{}, err
+		}
+	}
+}
+
+func (p *sassExprParser) parseUnary() (sassValue, error) {
+	t := p.peek()
+	if t == nil {
+		return sassValue{}, fmt.Errorf("expected an expression")
+	}
+	p.i++
+	switch t.kind {
+	case tokNumber:
+		return sassValue{kind: sassNumber, num: t.num, unit: t.unit}, nil
+	case tokString:
+		return sassValue{kind: sassString, str: t.text, quoted: true}, nil
+	case tokWord:
+		if t.text == "null" {
+			return sassValue{}, nil
+		}
+		return sassWord(t.text), nil
+	case tokVariable:
+		v, ok := p.ctx.scope.lookup(t.text)
+		if !ok {
+			return sassValue{}, fmt.Errorf("undefined variable $%s", t.text)
+		}
+		v.computed = true
+		return v, nil
+	case tokRaw:
+		s, err := p.c.substitute(p.ctx, t.text)
+		if err != nil {
+			return sassValue{}, err
+		}
+		return sassWord(s), nil
+	case tokOpen:
+		if isSassMap(p.toks[p.i:]) {
+			return sassValue{}, fmt.Errorf("maps are not supported")
+		}
+		p.paren++
+		v, err := p.parseList()
+		if err != nil {
+			return sassValue{}, err
+		}
+		p.paren--
+		if t := p.peek(); t == nil || t.kind != tokClose {
+			return sassValue{}, fmt.Errorf("expected \")\"")
+		}
+		p.i++
+		v.computed = true
+		return v, nil
+	case tokFunction:
+		if _, ok := sassFunctions[t.text]; !ok && (t.module != "" || unsupportedFunctions[t.text]) {
+			if t.module != "" {
+				return sassValue{}, fmt.Errorf("%s.%s() is not supported", t.module, t.text)
+			}
+			return sassValue{}, fmt.Errorf("%s() is not supported", t.text)
+		}
+		return p.parseCall(t.text)
+	case tokOp:
+		if t.text == "-" {
+			if n := p.peek(); n != nil && !n.space && (n.kind == tokVariable || n.kind == tokOpen || n.kind == tokFunction) {
+				v, err := p.parseUnary()
+				if err != nil {
+					return sassValue{}, err
+				}
+				if v.kind == sassNumber {
+					v.num = -v.num
+					return v, nil
+				}
+				return sassWord("-" + v.css(p.c.compressed)), nil
+			}
+		}
+		return sassWord(t.text), nil
+	}
+	return sassValue{}, fmt.Errorf("unexpected %q", t.text)
+}
+
+// isSassMap reports whether the parenthesis closed in toks holds the pairs
+// of a map, such as (small: 1px, large: 2px).
+func isSassMap(toks []sassToken) bool {
+	depth := 0
+	for _, t := range toks {
+		switch t.kind {
+		case tokOpen, tokFunction:
+			depth++
+		case tokClose:
+			if depth == 0 {
+				return false
+			}
+			depth--
+		case tokWord:
+			if depth == 0 && t.text == ":" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseCall parses the arguments of the function, and calls it if it is a
+// function of Sass. The other functions are CSS functions.
+func (p *sassExprParser) parseCall(name string) (sassValue, error) {
+	var args []sassValue
+	p.paren++
+	for {
+		t := p.peek()
+		if t == nil {
+			return sassValue{}, fmt.Errorf("expected \")\"")
+		}
+		if t.kind == tokClose {
+			p.i++
+			break
+		}
+		if t.kind == tokVariable && p.i+1 < len(p.toks) && p.toks[p.i+1].text == ":" {
+			// Keyword arguments are taken in order.
+			p.i += 2
+		}
+		v, err := p.parseSpaceList()
+		if err != nil {
+			return sassValue{}, err
+		}
+		args = append(args, v)
+		if t := p.peek(); t != nil && t.kind == tokComma {
+			p.i++
+		}
+	}
+	p.paren--
+	if f, ok := sassFunctions[name]; ok {
+		v, err := f(args)
+		if err != nil {
+			return sassValue{}, fmt.Errorf("%s(): %v", name, err)
+		}
+		v.computed = true
+		return v, nil
+	}
+	parts := make([]string, len(args))
+	for i, a := range args {
+		parts[i] = a.css(p.c.compressed)
+	}
+	sep := ", "
+	if p.c.compressed {
+		sep = ","
+	}
+	return sassWord(name + "(" + strings.Join(parts, sep) + ")"), nil
+}
+
+// sassOperate returns the value of the operation.
+func sassOperate(op string, a, b sassValue, compressed bool) (sassValue, error) {
+	if a.kind == sassNumber && b.kind == sassNumber {
+		unit := a.unit
+		if unit == "" {
+			unit = b.unit
+		}
+		switch op {
+		case "+", "-", "%":
+			if a.unit != "" && b.unit != "" && a.unit != b.unit {
+				return sassValue{}, fmt.Errorf("incompatible units %s and %s", a.unit, b.unit)
+			}
+			switch op {
+			case "+":
+				return sassNum(a.num+b.num, unit), nil
+			case "-":
+				return sassNum(a.num-b.num, unit), nil
+			}
+			if b.num == 0 {
+				return sassValue{}, fmt.Errorf("division by zero")
+			}
+			return sassNum(math.Mod(a.num, b.num), unit), nil
+		case "*":
+			if a.unit != "" && b.unit != "" {
+				return sassValue{}, fmt.Errorf("%s*%s is not a valid CSS value", a.css(compressed), b.css(compressed))
+			}
+			return sassNum(a.num*b.num, unit), nil
+		case "/":
+			if b.num == 0 {
+				return sassValue{}, fmt.Errorf("division by zero")
+			}
+			switch {
+			case a.unit == b.unit:
+				unit = ""
+			case b.unit == "":
+				unit = a.unit
+			default:
+				return sassValue{}, fmt.Errorf("%s/%s is not a valid CSS value", a.css(compressed), b.css(compressed))
+			}
+			return sassNum(a.num/b.num, unit), nil
+		}
+	}
+	switch op {
+	case "+":
+		quoted := a.quoted
+		if a.kind != sassString {
+			quoted = b.quoted
+		}
+		return sassValue{kind: sassString, str: a.text() + b.text(), quoted: quoted, computed: true}, nil
+	case "-", "/":
+		return sassWord(a.css(compressed) + op + b.css(compressed)), nil
+	}
+	return sassValue{}, fmt.Errorf("undefined operation %s %s %s", a.css(compressed), op, b.css(compressed))
+}
+
+// sassFunctions are the functions of Sass. The namespaces of the modules,
+// such as math of math.div, are dropped.
+var sassFunctions = map[string]func(args []sassValue) (sassValue, error){
+	"div": func(args []sassValue) (sassValue, error) {
+		if err := sassArgs(args, 2, sassNumber); err != nil {
+			return sassValue{}, err
+		}
+		return sassOperate("/", args[0], args[1], false)
+	},
+	"percentage": func(args []sassValue) (sassValue, error) {
+		if err := sassArgs(args, 1, sassNumber); err != nil {
+			return sassValue{}, err
+		}
+		if args[0].unit != "" {
+			return sassValue{}, fmt.Errorf("%s is not unitless", args[0].css(false))
+		}
+		return sassNum(args[0].num*100, "%"), nil
+	},
+	"round": sassMath(math.Round),
+	"ceil":  sassMath(math.Ceil),
+	"floor": sassMath(math.Floor),
+	"abs":   sassMath(math.Abs),
+	"unquote": func(args []sassValue) (sassValue, error) {
+		if err := sassArgs(args, 1, sassString); err != nil {
+			return sassValue{}, err
+		}
+		return sassWord(args[0].str), nil
+	},
+	"quote": func(args []sassValue) (sassValue, error) {
+		if err := sassArgs(args, 1, sassString); err != nil {
+			return sassValue{}, err
+		}
+		return sassValue{kind: sassString, str: args[0].str, quoted: true}, nil
+	},
+	"lighten": func(args []sassValue) (sassValue, error) {
+		return sassAdjustLightness(args, 1)
+	},
+	"darken": func(args []sassValue) (sassValue, error) {
+		return sassAdjustLightness(args, -1)
+	},
+	"rgba": func(args []sassValue) (sassValue, error) {
+		if len(args) != 2 {
+			// rgba(r, g, b, a) is a CSS function.
+			parts := make([]string, len(args))
+			for i, a := range args {
+				parts[i] = a.css(false)
+			}
+			return sassWord("rgba(" + strings.Join(parts, ", ") + ")"), nil
+		}
+		r, g, b, _, err := sassColor(args[0])
+		if err != nil {
+			return sassValue{}, err
+		}
+		if args[1].kind != sassNumber {
+			return sassValue{}, fmt.Errorf("%s is not a number", args[1].css(false))
+		}
+		return sassRGBA(r, g, b, args[1].num), nil
+	},
+}
+
+// unsupportedFunctions are the functions of Sass which are not implemented.
+// They are errors rather than CSS functions, so that the CSS is not broken
+// silently. The functions of CSS with the same names, such as invert and
+// min, are left out.
+var unsupportedFunctions = map[string]bool{
+	"map-get": true, "map-merge": true, "map-remove": true, "map-keys": true,
+	"map-values": true, "map-has-key": true, "nth": true, "set-nth": true,
+	"length": true, "join": true, "append": true, "zip": true, "index": true,
+	"list-separator": true, "is-bracketed": true, "if": true, "type-of": true,
+	"unit": true, "unitless": true, "comparable": true, "str-length": true,
+	"str-insert": true, "str-index": true, "str-slice": true,
+	"to-upper-case": true, "to-lower-case": true, "unique-id": true,
+	"mix": true, "adjust-hue": true, "desaturate": true, "complement": true,
+	"opacify": true, "fade-in": true, "transparentize": true, "fade-out": true,
+	"adjust-color": true, "scale-color": true, "change-color": true,
+	"red": true, "green": true, "blue": true, "hue": true, "saturation": true,
+	"lightness": true, "ie-hex-str": true, "variable-exists": true,
+	"global-variable-exists": true, "function-exists": true,
+	"mixin-exists": true, "content-exists": true, "feature-exists": true,
+	"inspect": true, "call": true, "get-function": true, "random": true,
+	"selector-nest": true, "selector-append": true, "selector-extend": true,
+	"selector-replace": true, "selector-unify": true, "simple-selectors": true,
+	"selector-parse": true, "is-superselector": true,
+}
+
+func sassArgs(args []sassValue, n int, kind int) error {
+	if len(args) != n {
+		return fmt.Errorf("takes %d arguments but got %d", n, len(args))
+	}
+	for _, a := range args {
+		if a.kind != kind {
+			return fmt.Errorf("unexpected argument %s", a.css(false))
+		}
+	}
+	return nil
+}
+
+func sassMath(f func(float64) float64) func(args []sassValue) (sassValue, error) {
+	return func(args []sassValue) (sassValue, error) {
+		if err := sassArgs(args, 1, sassNumber); err != nil {
+			return sassValue{}, err
+		}
+		return sassNum(f(args[0].num), args[0].unit), nil
+	}
+}
+
+// sassColor returns the components of the hexadecimal color.
+func sassColor(v sassValue) (r, g, b, a float64, err error) {
+	s := v.text()
+	if !strings.HasPrefix(s, "#") {
+		return 0, 0, 0, 0, fmt.Errorf("%s is not a color", s)
+	}
+	hex := s[1:]
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	n, perr := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 6 || perr != nil {
+		return 0, 0, 0, 0, fmt.Errorf("%s is not a color", s)
+	}
+	return float64(n >> 16 & 0xff), float64(n >> 8 & 0xff), float64(n & 0xff), 1, nil
+}
+
+func sassRGBA(r, g, b, a float64) sassValue {
+	// The components are rounded to 6 digits first, as 76.4999999 of the
+	// conversions of HSL is 76.5.
+	round := func(f float64) int {
+		return int(math.Round(math.Round(f*1e6) / 1e6))
+	}
+	if a >= 1 {
+		return sassWord(fmt.Sprintf("#%02x%02x%02x", round(r), round(g), round(b)))
+	}
+	return sassWord(fmt.Sprintf("rgba(%d, %d, %d, %s)", round(r), round(g), round(b), formatSassNumber(a, false)))
+}
+
+// sassAdjustLightness returns the color with the lightness in HSL changed by
+// the amount in percent, in the direction of sign.
+func sassAdjustLightness(args []sassValue, sign float64) (sassValue, error) {
+	if len(args) != 2 || args[1].kind != sassNumber {
+		return sassValue{}, fmt.Errorf("takes a color and an amount")
+	}
+	r, g, b, _, err := sassColor(args[0])
+	if err != nil {
+		return sassValue{}, err
+	}
+	h, s, l := rgbToHSL(r/255, g/255, b/255)
+	l = math.Max(0, math.Min(1, l+sign*args[1].num/100))
+	r, g, b = hslToRGB(h, s, l)
+	return sassRGBA(r*255, g*255, b*255, 1), nil
+}
+
+func rgbToHSL(r, g, b float64) (h, s, l float64) {
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	l = (max + min) / 2
+	if max == min {
+		return 0, 0, l
+	}
+	d := max - min
+	if l > 0.5 {
+		s = d / (2 - max - min)
+	} else {
+		s = d / (max + min)
+	}
+	switch max {
+	case r:
+		h = (g - b) / d
+		if g < b {
+			h += 6
+		}
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	return h / 6, s, l
+}
+
+func hslToRGB(h, s, l float64) (r, g, b float64) {
+	if s == 0 {
+		return l, l, l
+	}
+	q := l * (1 + s)
+	if l >= 0.5 {
+		q = l + s - l*s
+	}
+	p := 2*l - q
+	hue := func(t float64) float64 {
+		if t < 0 {
+			t++
+		}
+		if t > 1 {
+			t--
+		}
+		switch {
+		case t < 1.0/6:
+			return p + (q-p)*6*t
+		case t < 0.5:
+			return q
+		case t < 2.0/3:
+			return p + (q-p)*(2.0/3-t)*6
+		}
+		return p
+	}
+	return hue(h + 1.0/3), hue(h), hue(h - 1.0/3)
+}
@@ -0,0 +1,303 @@
+package site
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var layoutDefault = `
+<!DOCTYPE html>
+<html lang="ja">
+<head>
+    <meta charset="UTF-8">
+	<link rel="stylesheet" href="/css/site.css" media="all">
+    <title>Jedie is Awesome!</title>
+</head>
+<body>
+{{ content }}
+</body>
+</html>
+`[1:]
+
+var layoutPost = `
+---
+layout: default
+---
+<h2>{{ page.title }}</h2>
+<p class="meta">{{ page.date | date_to_string }}</p>
+
+<div class="post">
+{{ content }}
+</div>
+`[1:]
+
+var cssSite = `
+body {
+	font-family: Sans;
+}
+
+h1 {
+	color: darkgreen;
+}
+`[1:]
+
+var postsBlog = (`
+---
+layout: post
+title:  "Welcome to Jedie!"
+date:   2013-11-22 21:42:47
+---
+
+You'll find this post in your ` + "`_posts`" + ` directory - edit this post and re-build (or run with the ` + "`-w`" + ` switch) to see your changes!
+To add new posts, simply add a file in the ` + "`_posts`" + ` directory that follows the convention: YYYY-MM-DD-name-of-post.ext.
+
+Jekyll also offers powerful support for code snippets:
+
+    package main
+    
+    import "fmt"
+    
+    func main() {
+	    fmt.Println("こんにちわ世界")
+    }
+
+Check out the [Jedie][jedie-gh] for more info.
+
+[jedie-gh]: https://github.com/mattn/jedie
+`)[1:]
+
+var newPost = (`
+---
+layout: post
+title:  "New Post"
+---
+
+`)[1:]
+var topPage = `
+---
+layout: default
+title: Your New Jedie Site
+---
+<div id="home">
+  <h1>Blog Posts</h1>
+  <ul class="posts">
+    {% for post in site.posts %}
+      <li><span>{{ post.date | date_to_string }}</span> &raquo; <a href="{{ post.url }}">{{ post.title }}</a></li>
+    {% endfor %}
+  </ul>
+</div>
+`[1:]
+
+var rssXML = `
+---
+layout: nil
+---
+<?xml version="1.0" encoding="utf-8" ?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">
+  <channel>
+    <title>{{ site.name | xml_escape }}</title>
+    <link>{{ site.description | xml_escape }}</link>
+    <atom:link rel="self" type="application/rss+xml" href="{{ site.baseurl | xml_escape }}{{ page.url | xml_escape}}" />
+    <description>{{ site.description | xml_escape }}</description>
+    <pubDate>{{ site.time | date:"%a, %d %b %Y %H:%M:%S +0900" }}</pubDate>
+    <lastBuildDate>{{ site.time | date:"%a, %d %b %Y %H:%M:%S +0900" }}</lastBuildDate>
+    {% for post in site.posts | limit:25 %}
+    <item>
+      <title>{{ post.title | xml_escape }}</title>
+      <link>{{ site.baseurl | xml_escape }}{{ post.url | xml_escape }}</link>
+      <guid isPermaLink="false">tag:vim-jp.org,{{ post.date | date:"%Y/%m/%d" }}:{{ post.url | xml_escape }},rev:1</guid>
+      <pubDate>{{ post.date | date:"%a, %d %b %Y %H:%M:%S +0900" }}</pubDate>
+      <author>vim-jp</author>
+      <description>{{ post.content | xml_escape }}</description>
+    </item>
+    {% endfor %}
+  </channel> 
+</rss>
+`[1:]
+
+var searchHTML = `
+<div class="search">
+  <input type="search" id="search-input" placeholder="Search" autocomplete="off">
+  <ul id="search-results"></ul>
+</div>
+<script>
+(function() {
+  var index = {{ site.search_index | jsonify }};
+  var input = document.getElementById("search-input");
+  var results = document.getElementById("search-results");
+  if (!index || !input) return;
+  var docs = null;
+
+  // tokenize splits the text the same way as the index: words are
+  // lowercased, and the runs of CJK characters are split into bigrams.
+  function tokenize(s) {
+    var cjk = /[\p{Script=Han}\p{Script=Hiragana}\p{Script=Katakana}\p{Script=Hangul}ー]+/u;
+    var tokens = [];
+    (s.match(/[\p{Script=Han}\p{Script=Hiragana}\p{Script=Katakana}\p{Script=Hangul}ー]+|[\p{L}\p{N}]+/gu) || []).forEach(function(t) {
+      if (!cjk.test(t)) {
+        tokens.push(t.toLowerCase());
+        return;
+      }
+      var rs = Array.from(t);
+      if (rs.length == 1) tokens.push(t);
+      for (var i = 0; i + 1 < rs.length; i++) tokens.push(rs[i] + rs[i + 1]);
+    });
+    return tokens;
+  }
+
+  function load() {
+    if (docs) return Promise.resolve(docs);
+    return fetch(index).then(function(r) { return r.json(); }).then(function(data) {
+      if (!data.shards) return data.docs;
+      return Promise.all(data.shards.map(function(url) {
+        return fetch(url).then(function(r) { return r.json(); });
+      })).then(function(shards) {
+        return [].concat.apply([], shards.map(function(shard) { return shard.docs; }));
+      });
+    }).then(function(all) { return docs = all; });
+  }
+
+  function matches(doc, token) {
+    return doc.tokens.some(function(t) { return t.indexOf(token) == 0; });
+  }
+
+  function search(query) {
+    var tokens = tokenize(query);
+    if (tokens.length == 0) return [];
+    return docs.filter(function(doc) {
+      return tokens.every(function(token) { return matches(doc, token); });
+    }).map(function(doc) {
+      var title = tokenize(doc.title || "");
+      var score = tokens.filter(function(token) {
+        return title.some(function(t) { return t.indexOf(token) == 0; });
+      }).length;
+      return {doc: doc, score: score};
+    }).sort(function(a, b) { return b.score - a.score; }).slice(0, 10);
+  }
+
+  input.addEventListener("input", function() {
+    load().then(function() {
+      results.innerHTML = "";
+      search(input.value).forEach(function(hit) {
+        var li = document.createElement("li");
+        var a = document.createElement("a");
+        a.href = hit.doc.url;
+        a.textContent = hit.doc.title || hit.doc.url;
+        li.appendChild(a);
+        results.appendChild(li);
+      });
+    });
+  });
+})();
+</script>
+`[1:]
+
+var configYml = `
+name: Your New Jedie Site
+description: You love golang, I love golang
+`[1:]
+
+func createDirectories(path string) error {
+	directories := []string{"_layouts", "_includes", "css", "_posts"}
+
+	for _, directory := range directories {
+		err := os.Mkdir(filepath.Join(path, directory), 0755)
+		if err != nil && !os.IsExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func createFiles(path string) error {
+	files := []struct {
+		first       string
+		last        string
+		templateVar string
+	}{
+		{"_config.yml", "", configYml},
+		{"_layouts", "default.html", layoutDefault},
+		{"_layouts", "post.html", layoutPost},
+		{"_includes", "search.html", searchHTML},
+		{"css", "site.css", cssSite},
+		{"_posts", time.Now().Format("2006-01-02-welcome-to-jedie.md"), postsBlog},
+		{"index.html", "", topPage},
+		{"rss.xml", "", rssXML},
+	}
+
+	for _, file := range files {
+		err := ioutil.WriteFile(filepath.Join(path, file.first, file.last), []byte(file.templateVar), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Create creates a new site scaffold in path.
+func Create(path string) error {
+	return generateScaffold(path)
+}
+
+// CreateWithTheme creates a new site in path which uses the theme directory.
+func CreateWithTheme(path, theme string) error {
+	return generateThemedScaffold(path, theme)
+}
+
+func generateScaffold(path string) error {
+	err := createDirectories(path)
+
+	if err != nil {
+		return err
+	}
+
+	err = createFiles(path)
+
+	return err
+}
+
+// generateThemedScaffold creates a site which takes the layouts and assets
+// from the theme directory.
+func generateThemedScaffold(path, theme string) error {
+	if fi, err := os.Stat(theme); err != nil || !fi.IsDir() {
+		return fmt.Errorf("theme: %s: not found", theme)
+	}
+	absTheme, err := filepath.Abs(theme)
+	if err != nil {
+		return err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(absPath, absTheme); err == nil {
+		theme = rel
+	} else {
+		theme = absTheme
+	}
+
+	err = os.Mkdir(filepath.Join(path, "_posts"), 0755)
+	if err != nil && !os.IsExist(err) {
+		return err
+	}
+	files := []struct {
+		name        string
+		templateVar string
+	}{
+		{"_config.yml", configYml + "theme: " + filepath.ToSlash(theme) + "\n"},
+		{filepath.Join("_posts", time.Now().Format("2006-01-02-welcome-to-jedie.md")), postsBlog},
+		{"index.html", topPage},
+	}
+	for _, file := range files {
+		err := ioutil.WriteFile(filepath.Join(path, file.name), []byte(file.templateVar), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,4 +1,4 @@
-package main
+package site
 
 import (
 	"io/ioutil"
@@ -20,6 +20,7 @@ func TestTemplate(t *testing.T) {
 		{postsBlog, "layout: post", true},
 		{topPage, "title: Your New Jedie Site", true},
 		{rssXML, "<rss version", true},
+		{searchHTML, "site.search_index", true},
 		{configYml, "Your New Jedie Site", true},
 	}
 
@@ -46,6 +47,7 @@ func TestGenerateScaffold(t *testing.T) {
 		{"_config.yml", true},
 		{"_layouts/default.html", true},
 		{"_layouts/post.html", true},
+		{"_includes/search.html", true},
 		{"css/site.css", true},
 		{"_posts/" + time.Now().Format("2006-01-02-welcome-to-jedie.md"), true},
 		{"index.html", true},
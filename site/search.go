@@ -0,0 +1,302 @@
+package site
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/flosch/pongo2"
+)
+
+// search configures the JSON index of the posts and pages for the search on
+// the client side:
+//
+//	search:
+//	  path: search.json
+//	  fields: [title, url, date, tags, excerpt]
+//	  excerpt_length: 200
+//	  shard_size: 500
+//
+// The index is written when Path is set. Fields are title, url, date, tags,
+// categories, content, excerpt or the other keys of the front matter. Every
+// document also has the tokens of its title, tags and content, and the pages
+// with search: false in the front matter are left out.
+//
+// With ShardSize, the documents of the larger sites are split into the
+// shards such as search-1.json, and Path lists their URLs.
+type search struct {
+	Path          string   `yaml:"path"`
+	Fields        []string `yaml:"fields"`
+	ExcerptLength int      `yaml:"excerpt_length"`
+	ShardSize     int      `yaml:"shard_size"`
+}
+
+// checkSearch checks the config of the search index, and sets the defaults.
+func (cfg *config) checkSearch() error {
+	if cfg.Search.Path == "" {
+		return nil
+	}
+	if _, err := generatorPath(cfg.Destination, cfg.Search.Path); err != nil {
+		return fmt.Errorf("search: path: %v", err)
+	}
+	if len(cfg.Search.Fields) == 0 {
+		cfg.Search.Fields = []string{"title", "url", "date", "tags", "categories", "content"}
+	}
+	if cfg.Search.ExcerptLength < 0 {
+		return fmt.Errorf("search: excerpt_length must not be negative")
+	}
+	if cfg.Search.ExcerptLength == 0 {
+		cfg.Search.ExcerptLength = 200
+	}
+	if cfg.Search.ShardSize < 0 {
+		return fmt.Errorf("search: shard_size must not be negative")
+	}
+	return nil
+}
+
+// searchDest returns the path of the search index in the destination.
+func (cfg *config) searchDest() string {
+	return cfg.Destination + "/" + path.Clean(cfg.Search.Path)
+}
+
+// searchShards returns the paths of the shards of the index for n documents
+// in the destination, or nil if the index is not sharded.
+func (cfg *config) searchShards(n int) []string {
+	size := cfg.Search.ShardSize
+	if size == 0 || n <= size {
+		return nil
+	}
+	to := cfg.searchDest()
+	ext := path.Ext(to)
+	var shards []string
+	for i := 0; i*size < n; i++ {
+		shards = append(shards, fmt.Sprintf("%s-%d%s", strings.TrimSuffix(to, ext), i+1, ext))
+	}
+	return shards
+}
+
+// searchPages returns the posts and pages written as HTML, without the pages
+// excluded by the front matter.
+func (cfg *config) searchPages(posts, pages []pongo2.Context) []pongo2.Context {
+	var found []pongo2.Context
+	for _, page := range append(append([]pongo2.Context{}, posts...), pages...) {
+		from := page["path"].(string)
+		if !cfg.isConvertable(from) || cfg.isSass(from) {
+			continue
+		}
+		to := cfg.pageDest(from, page)
+		if cfg.isPost(from) {
+			to = cfg.toPost(from, page)
+		}
+		if path.Ext(to) != ".html" {
+			continue
+		}
+		if v, ok := page["search"].(bool); ok && !v {
+			continue
+		}
+		found = append(found, page)
+	}
+	return found
+}
+
+// recordRendered keeps the body of the page src rendered without the
+// layouts, for the search index.
+func (cfg *config) recordRendered(src, content string) {
+	if cfg.rendered == nil {
+		return
+	}
+	if _, ok := cfg.rendered[src]; !ok {
+		cfg.rendered[src] = content
+	}
+}
+
+var (
+	searchSkip = regexp.MustCompile(`(?is)<(script|style)\b.*?</(script|style)>`)
+	searchTag  = regexp.MustCompile(`<[^>]*>`)
+)
+
+// plainText returns the text of the HTML s with the spaces collapsed.
+func plainText(s string) string {
+	s = searchSkip.ReplaceAllString(s, " ")
+	s = searchTag.ReplaceAllString(s, " ")
+	return strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+}
+
+// tokenize calls emit with the tokens of s. The words are lowercased, and
+// the runs of CJK characters are split into the bigrams, as they have no
+// spaces between the words.
+func tokenize(s string, emit func(token string)) {
+	var word, cjk []rune
+	flush := func() {
+		if len(word) > 0 {
+			emit(strings.ToLower(string(word)))
+			word = word[:0]
+		}
+		if len(cjk) == 1 {
+			emit(string(cjk))
+		}
+		for i := 0; i+1 < len(cjk); i++ {
+			emit(string(cjk[i : i+2]))
+		}
+		cjk = cjk[:0]
+	}
+	for _, r := range s {
+		switch {
+		case isCJK(r) || r == 'ー':
+			if len(word) > 0 {
+				flush()
+			}
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			if len(cjk) > 0 {
+				flush()
+			}
+			word = append(word, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+}
+
+// searchTokens returns the sorted tokens of s without duplicates.
+func searchTokens(s string) []string {
+	seen := map[string]bool{}
+	tokenize(s, func(token string) {
+		seen[token] = true
+	})
+	tokens := make([]string, 0, len(seen))
+	for t := range seen {
+		tokens = append(tokens, t)
+	}
+	sort.Strings(tokens)
+	return tokens
+}
+
+// searchDoc returns the document of the page in the search index.
+func (cfg *config) searchDoc(page pongo2.Context) map[string]interface{} {
+	from := page["path"].(string)
+	content, ok := cfg.rendered[from]
+	if !ok {
+		content = str(page["content"])
+	}
+	text := plainText(content)
+	title := str(page["title"])
+	var tags []string
+	for _, key := range []string{"tags", "categories", "category"} {
+		tags = append(tags, toStrings(page[key])...)
+	}
+
+	doc := map[string]interface{}{}
+	for _, field := range cfg.Search.Fields {
+		switch field {
+		case "title":
+			doc[field] = title
+		case "url":
+			doc[field] = str(page["url"])
+		case "date":
+			if date, ok := page["date"].(time.Time); ok && !date.IsZero() {
+				doc[field] = date.Format(time.RFC3339)
+			}
+		case "tags", "categories":
+			doc[field] = toStrings(page[field])
+		case "content":
+			doc[field] = text
+		case "excerpt":
+			if rs := []rune(text); len(rs) > cfg.Search.ExcerptLength {
+				doc[field] = string(rs[:cfg.Search.ExcerptLength])
+			} else {
+				doc[field] = text
+			}
+		default:
+			switch v := page[field].(type) {
+			case nil:
+			case string, bool, int, float64:
+				doc[field] = v
+			case time.Time:
+				doc[field] = v.Format(time.RFC3339)
+			case []interface{}:
+				doc[field] = toStrings(v)
+			case []pongo2.Context:
+				// The related posts refer to each other.
+				urls := []string{}
+				for _, p := range v {
+					urls = append(urls, str(p["url"]))
+				}
+				doc[field] = urls
+			default:
+				doc[field] = fmt.Sprint(v)
+			}
+		}
+	}
+	doc["tokens"] = searchTokens(title + " " + strings.Join(tags, " ") + " " + text)
+	return doc
+}
+
+// toStrings returns the list of strings of the front matter value v, which
+// may be a list or a string separated by spaces.
+func toStrings(v interface{}) []string {
+	list := []string{}
+	switch v := v.(type) {
+	case []interface{}:
+		for _, e := range v {
+			list = append(list, fmt.Sprint(e))
+		}
+	case []string:
+		list = append(list, v...)
+	case string:
+		list = append(list, strings.Fields(v)...)
+	}
+	return list
+}
+
+// writeSearch writes the search index of the posts and pages rendered.
+func (cfg *config) writeSearch(ctx context.Context) error {
+	if cfg.Search.Path == "" {
+		return nil
+	}
+	docs := []map[string]interface{}{}
+	for _, page := range cfg.searchPages(cfg.posts, cfg.pages) {
+		docs = append(docs, cfg.searchDoc(page))
+	}
+
+	to := cfg.searchDest()
+	shards := cfg.searchShards(len(docs))
+	if shards == nil {
+		fmt.Fprintln(cfg.out(), to)
+		b, err := json.Marshal(map[string]interface{}{"docs": docs})
+		if err != nil {
+			return err
+		}
+		return cfg.writeFile(ctx, "", to, b)
+	}
+	urls := []string{}
+	for i, shard := range shards {
+		end := (i + 1) * cfg.Search.ShardSize
+		if end > len(docs) {
+			end = len(docs)
+		}
+		fmt.Fprintln(cfg.out(), shard)
+		b, err := json.Marshal(map[string]interface{}{"docs": docs[i*cfg.Search.ShardSize : end]})
+		if err != nil {
+			return err
+		}
+		if err := cfg.writeFile(ctx, "", shard, b); err != nil {
+			return err
+		}
+		urls = append(urls, urlJoin(cfg.Baseurl, shard[len(cfg.Destination):]))
+	}
+	fmt.Fprintln(cfg.out(), to)
+	b, err := json.Marshal(map[string]interface{}{"shards": urls, "total": len(docs)})
+	if err != nil {
+		return err
+	}
+	return cfg.writeFile(ctx, "", to, b)
+}
@@ -0,0 +1,170 @@
+package site
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSearchTokens(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"Hello, World! hello", []string{"hello", "world"}},
+		{"Go言語の本", []string{"go", "の本", "言語", "語の"}},
+		{"日 本", []string{"日", "本"}},
+		{"データベース", []string{"タベ", "デー", "ベー", "ース", "ータ"}},
+		{"한국어 Vim 8.2", []string{"2", "8", "vim", "국어", "한국"}},
+		{"", []string{}},
+	}
+	for _, test := range tests {
+		got := searchTokens(test.in)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: want %q but got %q", test.in, test.want, got)
+		}
+	}
+}
+
+// searchIndex builds the site of files, and returns the search index and
+// the outputs.
+func searchIndex(t *testing.T, config string, files map[string]string) (map[string]interface{}, *MemoryOutput) {
+	t.Helper()
+	fsys := fstest.MapFS{
+		"_config.yml": {Data: []byte(config)},
+		"_posts":      {Mode: fs.ModeDir},
+	}
+	for name, content := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+	out := NewMemoryOutput()
+	s := New(Options{FS: fsys, Output: out, Stdout: ioutil.Discard})
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Build(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	b, ok := out.ReadFile("search.json")
+	if !ok {
+		t.Fatalf("want search.json but got %v", out.Names())
+	}
+	var index map[string]interface{}
+	if err := json.Unmarshal(b, &index); err != nil {
+		t.Fatal(err)
+	}
+	return index, out
+}
+
+func TestSearch(t *testing.T) {
+	files := map[string]string{
+		"_layouts/default.html":         "<nav>Menu</nav>{{ content }}",
+		"_posts/2024-01-02-hello.md":    "---\nlayout: default\ntitle: Hello Go\ntags: [go, tips]\nlevel: 3\n---\n# Hi\n\n**Go** &amp; Vim <script>var x;</script>\n",
+		"_posts/2024-02-03-japanese.md": "---\ntitle: 日本語\n---\n全文検索のテスト\n",
+		"about.html":                    "---\ntitle: About\n---\n<p>{{ site.name }} site</p>\n",
+		"secret.html":                   "---\ntitle: Secret\nsearch: false\n---\nhidden\n",
+		"css/site.css":                  "body {}",
+		"feed.xml":                      "---\n---\n<feed/>",
+	}
+	index, _ := searchIndex(t, "name: Blog\nsearch:\n  path: search.json\n  fields: [title, url, date, tags, excerpt, level]\n  excerpt_length: 5", files)
+	docs := index["docs"].([]interface{})
+	if len(docs) != 3 {
+		t.Fatalf("want 3 documents but got %v", docs)
+	}
+
+	doc := docs[1].(map[string]interface{})
+	want := map[string]interface{}{
+		"title":   "Hello Go",
+		"url":     "/2024/01/02/hello.html",
+		"date":    doc["date"],
+		"tags":    []interface{}{"go", "tips"},
+		"excerpt": "Hi Go",
+		"level":   3.0,
+		"tokens":  []interface{}{"go", "hello", "hi", "tips", "vim"},
+	}
+	if !reflect.DeepEqual(doc, want) {
+		t.Fatalf("want %v but got %v", want, doc)
+	}
+	if !strings.HasPrefix(doc["date"].(string), "2024-01-02T") {
+		t.Fatalf("want the date but got %v", doc["date"])
+	}
+
+	doc = docs[0].(map[string]interface{})
+	tokens := doc["tokens"].([]interface{})
+	for _, token := range []string{"日本", "本語", "全文", "検索", "テス"} {
+		found := false
+		for _, t := range tokens {
+			found = found || t == token
+		}
+		if !found {
+			t.Fatalf("want %q in %v", token, tokens)
+		}
+	}
+
+	doc = docs[2].(map[string]interface{})
+	if doc["title"] != "About" || doc["excerpt"] != "Blog " {
+		t.Fatalf("want the rendered page but got %v", doc)
+	}
+}
+
+func TestSearchShards(t *testing.T) {
+	files := map[string]string{}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		files[name+".html"] = "---\ntitle: " + name + "\n---\n" + name
+	}
+	index, out := searchIndex(t, "search:\n  path: search.json\n  fields: [title]\n  shard_size: 2", files)
+	want := map[string]interface{}{
+		"shards": []interface{}{"/search-1.json", "/search-2.json", "/search-3.json"},
+		"total":  5.0,
+	}
+	if !reflect.DeepEqual(index, want) {
+		t.Fatalf("want %v but got %v", want, index)
+	}
+	var titles []string
+	for _, shard := range []string{"search-1.json", "search-2.json", "search-3.json"} {
+		b, _ := out.ReadFile(shard)
+		var data struct {
+			Docs []struct{ Title string }
+		}
+		if err := json.Unmarshal(b, &data); err != nil {
+			t.Fatal(err)
+		}
+		for _, doc := range data.Docs {
+			titles = append(titles, doc.Title)
+		}
+	}
+	if len(titles) != 5 {
+		t.Fatalf("want 5 documents in the shards but got %v", titles)
+	}
+
+	for _, config := range []string{
+		"search:\n  path: ../search.json",
+		"search:\n  path: search.json\n  shard_size: -1",
+	} {
+		s := New(Options{FS: fstest.MapFS{"_config.yml": {Data: []byte(config)}}, Output: NewMemoryOutput()})
+		if err := s.Load(); err == nil || !strings.HasPrefix(err.Error(), "search: ") {
+			t.Errorf("%q: want a search error but got %v", config, err)
+		}
+	}
+}
+
+func TestSearchInclude(t *testing.T) {
+	for _, config := range []string{
+		"autoescape: true\nbaseurl: /a&b\n",
+		"template_engine: liquid\nbaseurl: /a&b\n",
+	} {
+		_, out := searchIndex(t, config+"search:\n  path: search.json", map[string]string{
+			"_includes/search.html": searchHTML,
+			"index.html":            "---\n---\n{% include search.html %}",
+		})
+		b, _ := out.ReadFile("index.html")
+		if !strings.Contains(string(b), `var index = "/a\u0026b/search.json";`) {
+			t.Fatalf("%q: want the URL of the index but got %s", config, b)
+		}
+	}
+}
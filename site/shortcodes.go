@@ -0,0 +1,491 @@
+package site
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/flosch/pongo2"
+)
+
+// shortcodePlaceholder stands for the output of a shortcode until the
+// content is converted from Markdown, so the output is not mangled.
+const shortcodePlaceholder = "jedieshortcode%dx"
+
+// literalPlaceholder stands for a shortcode which is written as is, so it is
+// not taken for a template tag.
+const literalPlaceholder = "jedieliteral%dx"
+
+// shortcode is a shortcode call in content:
+//
+//	{{< figure src="/images/gopher.png" caption="Gopher" >}}
+//	{{< details summary="More" >}}inner content{{< /details >}}
+//
+// Arguments without a name are numbered from 0.
+type shortcode struct {
+	name    string
+	closing bool
+	self    bool
+	params  map[string]string
+	size    int
+}
+
+// scanShortcode reads the shortcode tag at the start of s.
+func scanShortcode(s string) (*shortcode, error) {
+	var quote byte
+	end := -1
+	for i := 3; i < len(s) && end < 0; i++ {
+		switch {
+		case quote != 0:
+			if s[i] == '\\' && quote == '"' {
+				i++
+			} else if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case strings.HasPrefix(s[i:], ">}}"):
+			end = i
+		}
+	}
+	if end < 0 {
+		return nil, fmt.Errorf("unterminated shortcode")
+	}
+
+	sc := &shortcode{params: map[string]string{}, size: end + 3}
+	body := strings.TrimSpace(s[3:end])
+	if strings.HasPrefix(body, "/") {
+		sc.closing = true
+		body = strings.TrimSpace(body[1:])
+	}
+	if strings.HasSuffix(body, "/") {
+		sc.self = true
+		body = strings.TrimSpace(body[:len(body)-1])
+	}
+	args, err := splitShortcodeArgs(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 || strings.Contains(args[0], "=") {
+		return nil, fmt.Errorf("shortcode name is required")
+	}
+	sc.name = args[0]
+	n := 0
+	for _, arg := range args[1:] {
+		key := strconv.Itoa(n)
+		if i := strings.Index(arg, "="); i > 0 && !strings.ContainsAny(arg[:i], `"'`) {
+			key, arg = arg[:i], arg[i+1:]
+		} else {
+			n++
+		}
+		value, err := unquoteShortcodeArg(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", sc.name, err)
+		}
+		sc.params[key] = value
+	}
+	return sc, nil
+}
+
+// splitShortcodeArgs splits the arguments on spaces out of quotes.
+func splitShortcodeArgs(s string) ([]string, error) {
+	var args []string
+	var quote byte
+	start := -1
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if start >= 0 {
+				args = append(args, s[start:i])
+				start = -1
+			}
+			continue
+		case c == '"' || c == '\'':
+			quote = c
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if start >= 0 {
+		args = append(args, s[start:])
+	}
+	return args, nil
+}
+
+func unquoteShortcodeArg(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		return strconv.Unquote(s)
+	case strings.HasPrefix(s, `'`):
+		return strings.Trim(s, `'`), nil
+	}
+	return s, nil
+}
+
+// codeRanges returns the ranges of the fenced code blocks and the code spans
+// in Markdown content, in which shortcodes are left alone.
+func codeRanges(s string) [][2]int {
+	var ranges [][2]int
+	bol := true
+	for i := 0; i < len(s); {
+		if bol {
+			bol = false
+			j := i
+			for j < len(s) && j-i < 3 && s[j] == ' ' {
+				j++
+			}
+			if fence := fenceLen(s[j:]); fence > 0 {
+				// The block ends with a fence of the same character which
+				// is at least as long, or at the end of the content.
+				end := len(s)
+				for k := i + len(lineOf(s[i:])); k < len(s); k += len(lineOf(s[k:])) {
+					k++
+					t := strings.TrimLeft(lineOf(s[k:]), " ")
+					if n := fenceLen(t); n >= fence && t[0] == s[j] && strings.TrimSpace(t[n:]) == "" {
+						end = k + len(lineOf(s[k:]))
+						break
+					}
+				}
+				ranges = append(ranges, [2]int{i, end})
+				i = end
+				continue
+			}
+		}
+		switch s[i] {
+		case '\n':
+			bol = true
+		case '`':
+			n := 1
+			for i+n < len(s) && s[i+n] == '`' {
+				n++
+			}
+			// A code span ends with a run of the same number of backticks.
+			end := -1
+			for j := i + n; j < len(s); {
+				if s[j] != '`' {
+					j++
+					continue
+				}
+				m := 1
+				for j+m < len(s) && s[j+m] == '`' {
+					m++
+				}
+				if m == n {
+					end = j + m
+					break
+				}
+				j += m
+			}
+			if end < 0 {
+				i += n
+				continue
+			}
+			ranges = append(ranges, [2]int{i, end})
+			i = end
+			continue
+		}
+		i++
+	}
+	return ranges
+}
+
+// fenceLen returns the length of the code fence at the start of s, or 0.
+func fenceLen(s string) int {
+	if s == "" || (s[0] != '`' && s[0] != '~') {
+		return 0
+	}
+	n := 1
+	for n < len(s) && s[n] == s[0] {
+		n++
+	}
+	if n < 3 || (s[0] == '`' && strings.Contains(lineOf(s[n:]), "`")) {
+		return 0
+	}
+	return n
+}
+
+// lineOf returns s until the end of the line.
+func lineOf(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// inCode returns the end of the code range containing i, or -1.
+func inCode(ranges [][2]int, i int) int {
+	for _, r := range ranges {
+		if r[0] <= i && i < r[1] {
+			return r[1]
+		}
+	}
+	return -1
+}
+
+// expandShortcodes renders the shortcodes in content, and replaces them with
+// placeholders which restoreShortcodes replaces with the outputs. Shortcodes
+// in code are left alone, and an escaped shortcode such as
+// {{</* name */>}} is written as the shortcode itself.
+func (cfg *config) expandShortcodes(src, content string) (string, []string, error) {
+	var b strings.Builder
+	var outputs []string
+	ranges := codeRanges(content)
+	pos := 0
+	for {
+		i := strings.Index(content[pos:], "{{<")
+		if i < 0 {
+			break
+		}
+		i += pos
+		b.WriteString(content[pos:i])
+		line := strings.Count(content[:i], "\n") + 1
+
+		literal := ""
+		if strings.HasPrefix(content[i:], "{{</*") {
+			end := strings.Index(content[i:], "*/>}}")
+			if end < 0 {
+				return "", nil, fmt.Errorf("%s:%d: unterminated shortcode", src, line)
+			}
+			literal = "{{<" + content[i+5:i+end] + ">}}"
+			pos = i + end + 5
+		} else if inCode(ranges, i) >= 0 {
+			literal = "{{<"
+			if sc, err := scanShortcode(content[i:]); err == nil {
+				literal = content[i : i+sc.size]
+			}
+			pos = i + len(literal)
+		}
+		if literal != "" {
+			fmt.Fprintf(&b, literalPlaceholder, len(outputs))
+			outputs = append(outputs, html.EscapeString(literal))
+			continue
+		}
+
+		sc, err := scanShortcode(content[i:])
+		if err != nil {
+			return "", nil, fmt.Errorf("%s:%d: %v", src, line, err)
+		}
+		if sc.closing {
+			return "", nil, fmt.Errorf("%s:%d: %s: no opening shortcode", src, line, sc.name)
+		}
+		pos = i + sc.size
+		if !sc.self {
+			inner, size, ok := shortcodeInner(content[pos:], sc.name)
+			if ok {
+				pos += size
+				// Shortcodes in the inner content are rendered first.
+				inner, innerOutputs, err := cfg.expandShortcodes(src, inner)
+				if err != nil {
+					return "", nil, err
+				}
+				sc.params["inner"] = restoreShortcodes(inner, innerOutputs)
+			}
+		}
+
+		output, err := cfg.renderShortcode(sc)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s:%d: %s: %v", src, line, sc.name, err)
+		}
+		fmt.Fprintf(&b, shortcodePlaceholder, len(outputs))
+		outputs = append(outputs, output)
+	}
+	b.WriteString(content[pos:])
+	return b.String(), outputs, nil
+}
+
+// shortcodeInner returns the content until the closing shortcode of name and
+// the size including the closing shortcode.
+func shortcodeInner(s, name string) (string, int, bool) {
+	ranges := codeRanges(s)
+	depth := 0
+	pos := 0
+	for {
+		i := strings.Index(s[pos:], "{{<")
+		if i < 0 {
+			return "", 0, false
+		}
+		i += pos
+		if end := inCode(ranges, i); end >= 0 {
+			pos = end
+			continue
+		}
+		if strings.HasPrefix(s[i:], "{{</*") {
+			pos = i + 5
+			continue
+		}
+		sc, err := scanShortcode(s[i:])
+		if err != nil {
+			return "", 0, false
+		}
+		pos = i + sc.size
+		if sc.name != name || sc.self {
+			continue
+		}
+		if !sc.closing {
+			depth++
+		} else if depth > 0 {
+			depth--
+		} else {
+			return s[:i], pos, true
+		}
+	}
+}
+
+// restoreShortcodes replaces the placeholders with the outputs. Markdown
+// wraps a placeholder on its own line in a paragraph, which is dropped.
+func restoreShortcodes(content string, outputs []string) string {
+	for i := len(outputs) - 1; i >= 0; i-- {
+		content = strings.Replace(content, fmt.Sprintf(literalPlaceholder, i), outputs[i], -1)
+		placeholder := fmt.Sprintf(shortcodePlaceholder, i)
+		content = strings.Replace(content, "<p>"+placeholder+"</p>", outputs[i], -1)
+		content = strings.Replace(content, placeholder, outputs[i], -1)
+	}
+	return content
+}
+
+// renderShortcode renders the shortcode with the template in the shortcodes
+// directory, or with the built-in one. The template gets the arguments as
+// shortcode.* and the inner content as shortcode.inner.
+func (cfg *config) renderShortcode(sc *shortcode) (string, error) {
+	path := cfg.lookup(cfg.Shortcodes, cfg.themePath("_shortcodes"), sc.name+".html")
+	if _, err := cfg.stat(path); err == nil {
+		params := pongo2.Context{}
+		for k, v := range sc.params {
+			params[k] = v
+		}
+		return cfg.engine().renderFile(path, pongo2.Context{"shortcode": params})
+	}
+	if fn, ok := builtinShortcodes[sc.name]; ok {
+		return fn(sc.params)
+	}
+	return "", fmt.Errorf("unknown shortcode")
+}
+
+var builtinShortcodes = map[string]func(map[string]string) (string, error){
+	"figure":  figureShortcode,
+	"youtube": youtubeShortcode,
+	"gist":    gistShortcode,
+	"details": detailsShortcode,
+}
+
+// shortcodeArg returns the named argument, or the positional one.
+func shortcodeArg(params map[string]string, name string, n int) string {
+	if v, ok := params[name]; ok {
+		return v
+	}
+	return params[strconv.Itoa(n)]
+}
+
+func writeAttr(b *strings.Builder, name, value string) {
+	if value != "" {
+		fmt.Fprintf(b, ` %s="%s"`, name, html.EscapeString(value))
+	}
+}
+
+// figureShortcode renders an image with a caption:
+//
+//	{{< figure src="/images/gopher.png" alt="Gopher" caption="The gopher" link="/gopher/" >}}
+func figureShortcode(params map[string]string) (string, error) {
+	src := shortcodeArg(params, "src", 0)
+	if src == "" {
+		return "", fmt.Errorf("src is required")
+	}
+	var b strings.Builder
+	b.WriteString("<figure")
+	writeAttr(&b, "class", params["class"])
+	b.WriteString(">")
+	if params["link"] != "" {
+		b.WriteString("<a")
+		writeAttr(&b, "href", params["link"])
+		b.WriteString(">")
+	}
+	b.WriteString("<img")
+	writeAttr(&b, "src", src)
+	fmt.Fprintf(&b, ` alt="%s"`, html.EscapeString(params["alt"]))
+	writeAttr(&b, "width", params["width"])
+	writeAttr(&b, "height", params["height"])
+	b.WriteString(">")
+	if params["link"] != "" {
+		b.WriteString("</a>")
+	}
+	if caption := params["caption"]; caption != "" {
+		fmt.Fprintf(&b, "<figcaption>%s</figcaption>", html.EscapeString(caption))
+	}
+	b.WriteString("</figure>")
+	return b.String(), nil
+}
+
+var youtubeID = regexp.MustCompile(`^[\w-]+$`)
+
+// youtubeShortcode embeds a YouTube video:
+//
+//	{{< youtube dQw4w9WgXcQ >}}
+func youtubeShortcode(params map[string]string) (string, error) {
+	id := shortcodeArg(params, "id", 0)
+	if !youtubeID.MatchString(id) {
+		return "", fmt.Errorf("invalid video id %q", id)
+	}
+	title := params["title"]
+	if title == "" {
+		title = "YouTube video"
+	}
+	var b strings.Builder
+	b.WriteString(`<div class="youtube"><iframe`)
+	writeAttr(&b, "src", "https://www.youtube-nocookie.com/embed/"+id)
+	writeAttr(&b, "title", title)
+	b.WriteString(` allow="encrypted-media; picture-in-picture" allowfullscreen loading="lazy"></iframe></div>`)
+	return b.String(), nil
+}
+
+// gistShortcode embeds a gist, or a file of it:
+//
+//	{{< gist mattn 7825545 >}}
+//	{{< gist user="mattn" id="7825545" file="main.go" >}}
+func gistShortcode(params map[string]string) (string, error) {
+	user, id := shortcodeArg(params, "user", 0), shortcodeArg(params, "id", 1)
+	if user == "" || id == "" {
+		return "", fmt.Errorf("user and id are required")
+	}
+	src := "https://gist.github.com/" + url.PathEscape(user) + "/" + url.PathEscape(id) + ".js"
+	if file := shortcodeArg(params, "file", 2); file != "" {
+		src += "?file=" + url.QueryEscape(file)
+	}
+	var b strings.Builder
+	b.WriteString("<script")
+	writeAttr(&b, "src", src)
+	b.WriteString("></script>")
+	return b.String(), nil
+}
+
+// detailsShortcode renders a disclosure widget. The inner content is
+// Markdown:
+//
+//	{{< details summary="Show the code" >}}inner content{{< /details >}}
+func detailsShortcode(params map[string]string) (string, error) {
+	var b strings.Builder
+	b.WriteString("<details")
+	if params["open"] == "true" {
+		b.WriteString(" open")
+	}
+	b.WriteString(">")
+	if summary := shortcodeArg(params, "summary", 0); summary != "" {
+		fmt.Fprintf(&b, "<summary>%s</summary>", html.EscapeString(summary))
+	}
+	b.WriteString("\n" + markdownify(params["inner"]) + "</details>")
+	return b.String(), nil
+}
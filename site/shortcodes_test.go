@@ -0,0 +1,92 @@
+package site
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flosch/pongo2"
+)
+
+func TestShortcodes(t *testing.T) {
+	dir, cfg := makeSite("name: jedie", map[string]string{
+		"_shortcodes/callout.html": `<aside class="{{ shortcode.type }}">{{ shortcode.inner }}</aside>`,
+		"_shortcodes/figure.html":  `<img src="{{ shortcode.src }}">`,
+	})
+	defer os.RemoveAll(dir)
+	cfg.vars["site"] = pongo2.Context{"name": cfg.Name}
+
+	tests := []struct {
+		in  string
+		out string
+		err string
+	}{
+		{
+			in:  `{{< youtube dQw4w9WgXcQ >}}`,
+			out: `<div class="youtube"><iframe src="https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ" title="YouTube video" allow="encrypted-media; picture-in-picture" allowfullscreen loading="lazy"></iframe></div>`,
+		},
+		{
+			in:  `{{< gist mattn 7825545 file="main.go" >}}`,
+			out: `<script src="https://gist.github.com/mattn/7825545.js?file=main.go"></script>`,
+		},
+		{
+			in:  "{{< details summary=\"Code & more\" >}}\n*inner*\n{{< /details >}}",
+			out: "<details><summary>Code &amp; more</summary>\n<p><em>inner</em></p>\n</details>",
+		},
+		{
+			in:  "# {{ page.title }}\n\n{{< callout type=\"note\" >}}see {{< youtube \"abc\" />}}{{< /callout >}}\n\ntext",
+			out: `<h1>Shortcodes</h1>` + "\n\n" + `<aside class="note">see <div class="youtube"><iframe src="https://www.youtube-nocookie.com/embed/abc" title="YouTube video" allow="encrypted-media; picture-in-picture" allowfullscreen loading="lazy"></iframe></div></aside>` + "\n\n<p>text</p>",
+		},
+		{
+			// Templates of the site take precedence over built-ins.
+			in:  `{{< figure src="a_b.png" >}}`,
+			out: `<img src="a_b.png">`,
+		},
+		{
+			// Shortcodes in code are left alone.
+			in:  "Use `{{< tweet 1 >}}`.\n\n```\n{{< tweet 1 >}}\n```",
+			out: "<p>Use <code>{{&lt; tweet 1 &gt;}}</code>.</p>\n\n<pre><code>{{&lt; tweet 1 &gt;}}\n</code></pre>",
+		},
+		{
+			in:  "~~~~\n~~~\n{{< tweet 1 >}}\n~~~~\n\n{{< youtube abc >}}",
+			out: "<pre><code>~~~\n{{&lt; tweet 1 &gt;}}\n</code></pre>\n\n" + `<div class="youtube"><iframe src="https://www.youtube-nocookie.com/embed/abc" title="YouTube video" allow="encrypted-media; picture-in-picture" allowfullscreen loading="lazy"></iframe></div>`,
+		},
+		{
+			// An escaped shortcode is written as the shortcode itself.
+			in:  "{{</* youtube abc */>}}\n\n    {{</* details */>}}",
+			out: "<p>{{&lt; youtube abc &gt;}}</p>\n\n<pre><code>{{&lt; details &gt;}}\n</code></pre>",
+		},
+		{in: `{{< tweet 1 >}}`, err: "test.md:1: tweet: unknown shortcode"},
+		{in: "`{{< tweet 1 >}}` {{< tweet 1 >}}", err: "test.md:1: tweet: unknown shortcode"},
+		{in: "{{</* youtube abc >}}", err: "test.md:1: unterminated shortcode"},
+		{in: "\n{{< youtube \"abc >}}", err: "test.md:2: unterminated"},
+		{in: `{{< youtube "a<b" >}}`, err: `invalid video id "a<b"`},
+	}
+	for _, test := range tests {
+		from := filepath.ToSlash(filepath.Join(dir, "test.md"))
+		to := filepath.Join(dir, "_site", "test.html")
+		if err := ioutil.WriteFile(from, []byte("---\ntitle: Shortcodes\n---\n"+test.in), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := cfg.convertFile(context.Background(), from, to)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("%s: want error %q but got %v", test.in, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.in, err)
+		}
+		b, err := ioutil.ReadFile(to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSpace(string(b)); got != test.out {
+			t.Errorf("%s: want %q but got %q", test.in, test.out, got)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Package site builds jedie sites. It is what the jedie command runs, and
+// may be used to build sites from other Go programs:
+//
+//	s := site.New(site.Options{Config: "_config.yml"})
+//	if err := s.Load(); err != nil {
+//		log.Fatal(err)
+//	}
+//	if err := s.Build(context.Background()); err != nil {
+//		log.Fatal(err)
+//	}
+package site
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// Options are the options of a site.
+type Options struct {
+	// Config is the path of the config file. The default is _config.yml.
+	Config string
+	// Source and Destination override the directories of the config.
+	Source      string
+	Destination string
+	// WarnCollisions warns instead of failing the build when files are
+	// written to the same path.
+	WarnCollisions bool
+	// Stdout is where the files written are reported. The default is
+	// os.Stdout.
+	Stdout io.Writer
+	// FS is the file system where the site is read from, such as an
+	// embed.FS. The root of FS is the directory of the site, and the paths of
+	// the config are relative to it. The default is the disk, with paths
+	// relative to the working directory.
+	FS fs.FS
+	// Output is where the site is written. The default is the destination
+	// directory. Output is required with FS.
+	Output Output
+}
+
+// Site is a jedie site.
+type Site struct {
+	opts  Options
+	cfg   *config
+	hooks map[string][]Hook
+}
+
+// New returns a site with the options. Call Load to read its config.
+func New(opts Options) *Site {
+	return &Site{opts: opts, cfg: &config{}, hooks: map[string][]Hook{}}
+}
+
+// Load reads the config of the site.
+func (s *Site) Load() error {
+	file := s.opts.Config
+	if file == "" {
+		file = "_config.yml"
+	}
+	if s.opts.FS != nil && s.opts.Output == nil {
+		return fmt.Errorf("an output is required to build a site from an fs.FS")
+	}
+	cfg := &config{output: s.opts.Output, site: s}
+	if err := cfg.initFS(s.opts.FS); err != nil {
+		return err
+	}
+	if err := cfg.load(file); err != nil {
+		return err
+	}
+	if s.opts.Source != "" {
+		cfg.Source = cfg.abs(s.opts.Source)
+	}
+	if s.opts.Destination != "" {
+		cfg.Destination = cfg.abs(s.opts.Destination)
+	}
+	if s.opts.WarnCollisions {
+		cfg.WarnCollisions = true
+	}
+	cfg.stdout = s.opts.Stdout
+	s.cfg = cfg
+	return nil
+}
+
+// Source returns the source directory of the site.
+func (s *Site) Source() string {
+	return s.cfg.Source
+}
+
+// Destination returns the directory where the site is built. The names
+// written to an Output are relative to it.
+func (s *Site) Destination() string {
+	return s.cfg.Destination
+}
+
+// On registers the hook called on the event. The hooks of an event are
+// called in the order registered, after the hook commands of the config.
+func (s *Site) On(event string, hook Hook) {
+	s.hooks[event] = append(s.hooks[event], hook)
+}
+
+// Build builds the site to the destination. Builds of sites in a process
+// run one at a time.
+func (s *Site) Build(ctx context.Context) error {
+	return s.cfg.build(ctx)
+}
+
+// Render returns the output of the page or post at path, rendered through
+// its layouts. The site is read at the first call.
+func (s *Site) Render(path string) (string, error) {
+	buildMu.Lock()
+	defer buildMu.Unlock()
+	if s.cfg.pages == nil {
+		if err := s.cfg.read(context.Background()); err != nil {
+			return "", err
+		}
+	} else {
+		pongoSetup(s.cfg)
+	}
+	path = s.cfg.abs(path)
+	if !s.cfg.isConvertable(path) {
+		return "", fmt.Errorf("%s: not a page", path)
+	}
+	return s.cfg.render(context.Background(), path)
+}
+
+// Serve builds the site and serves it, rebuilding the files changed, until
+// ctx is done.
+func (s *Site) Serve(ctx context.Context) error {
+	return s.cfg.serve(ctx)
+}
+
+// CacheStats returns the statistics of the cache of the conversion outputs.
+func (s *Site) CacheStats() (CacheStats, error) {
+	return s.cfg.cacheStats()
+}
+
+// ClearCache removes the outputs cached in the cache directory. The other
+// files in it are left alone.
+func (s *Site) ClearCache() error {
+	return s.cfg.clearCache()
+}
+
+// NewPost creates a post named name in the posts directory.
+func (s *Site) NewPost(name string) error {
+	return s.cfg.newPost(name)
+}
@@ -0,0 +1,184 @@
+package site
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/fs"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/flosch/pongo2"
+)
+
+func TestSite(t *testing.T) {
+	dir, _ := makeSite("name: jedie\npermalink: pretty", map[string]string{
+		"_layouts/default.html":      "<title>{{ site.name }}</title>{{ content }}",
+		"_posts/2013-11-23-hello.md": "---\nlayout: default\ntitle: Hello\n---\n*hello*",
+		"about.html":                 "---\nlayout: default\n---\n{% for post in site.posts %}{{ post.title }}{% endfor %}",
+	})
+	defer os.RemoveAll(dir)
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout bytes.Buffer
+	s := New(Options{Destination: "public", Stdout: &stdout})
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.ToSlash(filepath.Join(dir, "public")); s.Destination() != want {
+		t.Fatalf("want destination %q but got %q", want, s.Destination())
+	}
+
+	out, err := s.Render("about.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<title>jedie</title>Hello"; out != want {
+		t.Fatalf("want %q but got %q", want, out)
+	}
+
+	var built []string
+	s.On(PostBuild, func(ctx context.Context, s *Site, e *Event) error {
+		built = append(built, e.Name)
+		return nil
+	})
+	if err := s.Build(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(built) != 1 || built[0] != PostBuild {
+		t.Fatalf("want post_build hook called once but got %v", built)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "public", "2013", "11", "23", "hello", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<title>jedie</title><p><em>hello</em></p>"; strings.TrimSpace(string(b)) != want {
+		t.Fatalf("want %q but got %q", want, string(b))
+	}
+	if !strings.Contains(stdout.String(), "about.html => ") {
+		t.Fatalf("want the files written reported but got %q", stdout.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Build(ctx); err != context.Canceled {
+		t.Fatalf("want %v but got %v", context.Canceled, err)
+	}
+}
+
+func TestSiteFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"_config.yml":                {Data: []byte("name: jedie\npermalink: pretty")},
+		"_layouts/default.html":      {Data: []byte("<title>{{ site.name }}</title>{{ content }}")},
+		"_includes/nav.html":         {Data: []byte("<nav>{{ page.title }}</nav>")},
+		"_posts/2013-11-23-hello.md": {Data: []byte("---\nlayout: default\ntitle: Hello\n---\n{% include \"nav.html\" %}*hello*")},
+		"css/site.css":               {Data: []byte("body{}")},
+	}
+
+	out := NewMemoryOutput()
+	s := New(Options{FS: fsys, Output: out, Stdout: ioutil.Discard})
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Build(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"2013/11/23/hello/index.html", "<title>jedie</title><p><nav>Hello</nav><em>hello</em></p>"},
+		{"css/site.css", "body{}"},
+	}
+	for _, test := range tests {
+		b, ok := out.ReadFile(test.name)
+		if !ok {
+			t.Fatalf("%s: not written, got %v", test.name, out.Names())
+		}
+		if got := strings.TrimSpace(string(b)); got != test.want {
+			t.Fatalf("%s: want %q but got %q", test.name, test.want, got)
+		}
+	}
+	if _, err := os.Stat("_site"); err == nil {
+		t.Fatal("want nothing written to the disk")
+	}
+
+	rec := httptest.NewRecorder()
+	out.ServeHTTP(rec, httptest.NewRequest("GET", "/2013/11/23/hello/", nil))
+	if !strings.Contains(rec.Body.String(), "<nav>Hello</nav>") {
+		t.Fatalf("want the post served but got %d %q", rec.Code, rec.Body.String())
+	}
+
+	var buf bytes.Buffer
+	zo := NewZipOutput(&buf)
+	s = New(Options{FS: fsys, Output: zo, Stdout: ioutil.Discard})
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Build(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := zo.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	if got, want := strings.Join(names, " "), strings.Join(out.Names(), " "); got != want {
+		t.Fatalf("want %q in the archive but got %q", want, got)
+	}
+
+	if err := New(Options{FS: fsys}).Load(); err == nil {
+		t.Fatal("want an error without an output")
+	}
+}
+
+func TestSiteConvertChanged(t *testing.T) {
+	newSite := func(config string) (*Site, *MemoryOutput) {
+		out := NewMemoryOutput()
+		s := New(Options{FS: fstest.MapFS{
+			"_config.yml": {Data: []byte(config)},
+			"_posts":      {Mode: fs.ModeDir},
+			"index.html":  {Data: []byte("---\nname: <b>\n---\n{{ page.name }}")},
+		}, Output: out, Stdout: ioutil.Discard})
+		if err := s.Load(); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Build(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return s, out
+	}
+	s, out := newSite("autoescape: false")
+	newSite("autoescape: true")
+
+	// The page changed is rendered with the settings of its own site.
+	from := s.cfg.abs("index.html")
+	if err := s.cfg.convertChanged(context.Background(), from, s.cfg.pageDest(from, pongo2.Context{})); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := out.ReadFile("index.html")
+	if got := strings.TrimSpace(string(b)); got != "<b>" {
+		t.Fatalf("want %q but got %q", "<b>", got)
+	}
+}
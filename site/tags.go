@@ -0,0 +1,299 @@
+package site
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/flosch/pongo2"
+	"github.com/osteele/liquid/render"
+)
+
+// indexLinks records the URLs of the posts and pages which are built, for
+// the post_url and link tags.
+func (cfg *config) indexLinks(posts, pages []pongo2.Context) {
+	cfg.links = map[string]string{}
+	cfg.postLinks = map[string]string{}
+	for _, page := range pages {
+		if rel := cfg.sourceRel(page["path"].(string)); rel != "" {
+			cfg.links[rel] = str(page["url"])
+		}
+	}
+	for _, post := range posts {
+		from := post["path"].(string)
+		if rel, err := filepath.Rel(cfg.Source, from); err == nil {
+			cfg.links[filepath.ToSlash(rel)] = str(post["url"])
+		}
+		if rel, err := filepath.Rel(cfg.Posts, from); err == nil {
+			rel = filepath.ToSlash(rel)
+			cfg.postLinks[rel[:len(rel)-len(filepath.Ext(rel))]] = str(post["url"])
+		}
+	}
+}
+
+// postURL returns the URL of the post named like 2013-11-23-welcome-to-jedie,
+// the file name in the posts directory without the extension.
+func (cfg *config) postURL(name string) (string, error) {
+	name = strings.TrimPrefix(strings.TrimSpace(name), "/")
+	if u, ok := cfg.postLinks[name]; ok {
+		return u, nil
+	}
+	return "", fmt.Errorf("post_url: no post named %q in %s", name, cfg.Posts)
+}
+
+// linkURL returns the URL of the page or post at the path relative to the
+// source directory.
+func (cfg *config) linkURL(path string) (string, error) {
+	path = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(strings.TrimSpace(path))), "/")
+	if u, ok := cfg.links[path]; ok {
+		return u, nil
+	}
+	return "", fmt.Errorf("link: no page or post at %q in %s", path, cfg.Source)
+}
+
+// setTag registers the pongo2 tag, replacing the one registered by an
+// earlier build.
+func setTag(name string, fn pongo2.TagParser) {
+	if err := pongo2.RegisterTag(name, fn); err != nil {
+		pongo2.ReplaceTag(name, fn)
+	}
+}
+
+type tagLinkNode struct {
+	arg     string
+	token   *pongo2.Token
+	resolve func(string) (string, error)
+}
+
+func (node *tagLinkNode) Execute(ctx *pongo2.ExecutionContext, writer pongo2.TemplateWriter) *pongo2.Error {
+	u, err := node.resolve(node.arg)
+	if err != nil {
+		return ctx.Error(err.Error(), node.token)
+	}
+	writer.WriteString(u)
+	return nil
+}
+
+// linkTag returns a pongo2 tag taking a bare or quoted name:
+//
+//	{% post_url 2013-11-23-welcome-to-jedie %}
+//	{% link "about.md" %}
+func linkTag(resolve func(string) (string, error)) pongo2.TagParser {
+	return func(doc *pongo2.Parser, start *pongo2.Token, arguments *pongo2.Parser) (pongo2.INodeTag, *pongo2.Error) {
+		// The name is lexed into several tokens such as 2013, -11 and
+		// welcome; it has no spaces, so join them back.
+		var arg string
+		for arguments.Remaining() > 0 {
+			arg += arguments.Current().Val
+			arguments.Consume()
+		}
+		if arg == "" {
+			return nil, arguments.Error("name is required", start)
+		}
+		return &tagLinkNode{arg: arg, token: start, resolve: resolve}, nil
+	}
+}
+
+func registerTags(cfg *config) {
+	setTag("post_url", linkTag(cfg.postURL))
+	setTag("link", linkTag(cfg.linkURL))
+	setTag("asset_url", linkTag(cfg.assetURL))
+	setTag("asset_integrity", linkTag(cfg.assetIntegrity))
+	setTag("asset_tag", linkTag(cfg.assetTag))
+	setTag("image", imageTag(cfg))
+	setTag("include", includeTag(cfg, false))
+	setTag("include_relative", includeTag(cfg, true))
+}
+
+// liquidLinkTag returns a Liquid tag taking a name, which may contain
+// {{ }} expressions.
+func liquidLinkTag(resolve func(string) (string, error)) func(render.Context) (string, error) {
+	return func(ctx render.Context) (string, error) {
+		arg, err := ctx.ExpandTagArg()
+		if err != nil {
+			return "", err
+		}
+		u, err := resolve(strings.Trim(strings.TrimSpace(arg), `"'`))
+		if err != nil {
+			return "", ctx.WrapError(err)
+		}
+		return u, nil
+	}
+}
+
+// maxIncludeDepth limits nested includes, so an include which includes
+// itself fails instead of recursing forever.
+const maxIncludeDepth = 16
+
+// includeDepthKey holds the depth of nested includes in the context.
+const includeDepthKey = "__include_depth"
+
+type tagIncludeNode struct {
+	cfg      *config
+	token    *pongo2.Token
+	name     string
+	expr     pongo2.IEvaluator
+	relative bool
+	with     bool
+	only     bool
+	ifExists bool
+	params   map[string]pongo2.IEvaluator
+}
+
+func (node *tagIncludeNode) Execute(ctx *pongo2.ExecutionContext, writer pongo2.TemplateWriter) *pongo2.Error {
+	name := node.name
+	if node.expr != nil {
+		v, err := node.expr.Evaluate(ctx)
+		if err != nil {
+			return err
+		}
+		name = v.String()
+		if name == "" {
+			return ctx.Error("file name is empty", node.token)
+		}
+	}
+	depth, _ := ctx.Public[includeDepthKey].(int)
+	if depth >= maxIncludeDepth {
+		return ctx.Error(fmt.Sprintf("%s: includes nested more than %d levels", name, maxIncludeDepth), node.token)
+	}
+	if node.relative {
+		base := node.token.Filename
+		if base == "<string>" {
+			// Content of pages is parsed from a string, so look at the
+			// path of the page.
+			if page, ok := ctx.Public["page"].(pongo2.Context); ok {
+				base = str(page["path"])
+			}
+		}
+		name = filepath.ToSlash(filepath.Join(filepath.Dir(base), name))
+		if node.cfg.sourceRel(name) == "" {
+			return ctx.Error(fmt.Sprintf("%s: outside of the source directory", name), node.token)
+		}
+	} else if node.ifExists {
+		if _, err := node.cfg.stat((&siteLoader{cfg: node.cfg}).Abs("", name)); err != nil {
+			return nil
+		}
+	}
+
+	tpl, err := node.cfg.templateSet().FromCache(name)
+	if err != nil {
+		return ctx.OrigError(err, node.token)
+	}
+
+	params := pongo2.Context{}
+	for k, v := range node.params {
+		value, err := v.Evaluate(ctx)
+		if err != nil {
+			return err
+		}
+		params[k] = value
+	}
+	vars := pongo2.Context{}
+	if !node.only {
+		vars.Update(ctx.Public)
+		vars.Update(ctx.Private)
+	}
+	if node.with {
+		// pongo2 passes the parameters after with as variables.
+		vars.Update(params)
+	}
+	vars["include"] = params
+	vars[includeDepthKey] = depth + 1
+	node.cfg.pushVars(vars)
+	defer node.cfg.popVars()
+	if err := tpl.ExecuteWriter(vars, writer); err != nil {
+		if perr, ok := err.(*pongo2.Error); ok {
+			return perr
+		}
+		return ctx.OrigError(err, node.token)
+	}
+	return nil
+}
+
+// templateExts are the extensions which make a bare name of the include tag
+// a file name rather than a variable, such as figure.html and page.sidebar.
+var templateExts = map[string]bool{
+	".html": true, ".htm": true, ".xml": true, ".txt": true, ".md": true, ".markdown": true,
+	".liquid": true, ".svg": true, ".json": true, ".js": true, ".css": true, ".rss": true, ".atom": true,
+}
+
+// includeTag returns the include tag of Jekyll, which also takes the options
+// of the include tag of pongo2:
+//
+//	{% include figure.html src="a.png" caption=page.title %}
+//	{% include "footer.html" with year=2013 only %}
+//	{% include page.sidebar %}
+//
+// A bare name with a path separator or an extension such as .html is a file
+// name, and the other names are expressions giving the file name.
+// The parameters are available as include.* in the included file. With
+// relative, the file is looked up from the directory of the current file
+// instead of the includes directory.
+func includeTag(cfg *config, relative bool) pongo2.TagParser {
+	return func(doc *pongo2.Parser, start *pongo2.Token, arguments *pongo2.Parser) (pongo2.INodeTag, *pongo2.Error) {
+		node := &tagIncludeNode{
+			cfg:      cfg,
+			token:    start,
+			relative: relative,
+			params:   map[string]pongo2.IEvaluator{},
+		}
+		isOption := func(shift int) bool {
+			t := arguments.GetR(shift)
+			if t == nil || t.Typ != pongo2.TokenIdentifier {
+				return false
+			}
+			switch t.Val {
+			case "with", "only", "if_exists":
+				return true
+			}
+			return arguments.PeekN(shift+1, pongo2.TokenSymbol, "=") != nil
+		}
+		// A bare file name such as figure.html is lexed into several
+		// tokens; it has no spaces, so join them back.
+		var bare string
+		for i := 0; i < arguments.Remaining() && !isOption(i); i++ {
+			bare += arguments.GetR(i).Val
+		}
+
+		switch {
+		case arguments.PeekType(pongo2.TokenString) != nil ||
+			arguments.PeekType(pongo2.TokenIdentifier) != nil && !strings.Contains(bare, "/") && !templateExts[path.Ext(bare)]:
+			expr, err := arguments.ParseExpression()
+			if err != nil {
+				return nil, err
+			}
+			node.expr = expr
+		default:
+			for arguments.Remaining() > 0 && !isOption(0) {
+				node.name += arguments.Current().Val
+				arguments.Consume()
+			}
+			if node.name == "" {
+				return nil, arguments.Error("file name is required", start)
+			}
+		}
+
+		for arguments.Remaining() > 0 {
+			switch {
+			case arguments.Match(pongo2.TokenIdentifier, "with") != nil:
+				node.with = true
+			case arguments.Match(pongo2.TokenIdentifier, "only") != nil:
+				node.only = true
+			case arguments.Match(pongo2.TokenIdentifier, "if_exists") != nil:
+				node.ifExists = true
+			default:
+				key := arguments.MatchType(pongo2.TokenIdentifier)
+				if key == nil || arguments.Match(pongo2.TokenSymbol, "=") == nil {
+					return nil, arguments.Error("expected key=value", nil)
+				}
+				value, err := arguments.ParseExpression()
+				if err != nil {
+					return nil, err
+				}
+				node.params[key.Val] = value
+			}
+		}
+		return node, nil
+	}
+}
@@ -0,0 +1,188 @@
+package site
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/flosch/pongo2"
+)
+
+// siteLoader loads the templates of a site. Relative names are looked up in
+// the includes directory and then in the layouts directory, front matter is
+// stripped, and files outside of the site are refused.
+type siteLoader struct {
+	cfg *config
+}
+
+func (l *siteLoader) Abs(base, name string) string {
+	if filepath.IsAbs(name) {
+		return filepath.ToSlash(filepath.Clean(name))
+	}
+	dirs := l.cfg.templateDirs()
+	for _, dir := range dirs {
+		p := filepath.ToSlash(filepath.Join(dir, name))
+		if _, err := l.cfg.stat(p); err == nil {
+			return p
+		}
+	}
+	return filepath.ToSlash(filepath.Join(dirs[0], name))
+}
+
+func (l *siteLoader) Get(path string) (io.Reader, error) {
+	path = l.Abs("", path)
+	if !l.cfg.inSite(path) {
+		return nil, fmt.Errorf("%s: outside of the site directory", path)
+	}
+	content, err := l.cfg.parseFile(path, pongo2.Context{})
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(content), nil
+}
+
+// inSite returns true if the file is in the source, includes, layouts,
+// shortcodes or theme directory.
+func (cfg *config) inSite(path string) bool {
+	path = filepath.ToSlash(filepath.Clean(path))
+	for _, dir := range []string{cfg.Source, cfg.Includes, cfg.Layouts, cfg.Shortcodes, cfg.themeDir} {
+		if dir == "" {
+			continue
+		}
+		if strings.HasPrefix(path, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// templateSet returns the template set of the site. Templates loaded from
+// files are cached until invalidated with CleanCache.
+func (cfg *config) templateSet() *pongo2.TemplateSet {
+	if cfg.tplset == nil {
+		cfg.tplset = pongo2.NewSet("jedie", &siteLoader{cfg: cfg})
+		// ssi reads files without the loader.
+		cfg.tplset.BanTag("ssi")
+	}
+	return cfg.tplset
+}
+
+func (cfg *config) isTemplate(path string) bool {
+	for _, dir := range []string{cfg.Layouts, cfg.Includes, cfg.Shortcodes} {
+		if strings.HasPrefix(path, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// templateEngine renders the pages, layouts and includes of a site.
+type templateEngine interface {
+	// renderString renders content read from the file src.
+	renderString(src, content string, vars pongo2.Context) (string, error)
+	// renderFile renders the template file such as a layout. The parsed
+	// template is cached.
+	renderFile(path string, vars pongo2.Context) (string, error)
+	// renderLayout renders the layout, filling its blocks with the blocks
+	// of the page where the engine supports it.
+	renderLayout(path string, blocks, vars pongo2.Context) (string, error)
+	// cleanCache drops all of the cached templates.
+	cleanCache()
+}
+
+// engine returns the template engine selected with template_engine.
+func (cfg *config) engine() templateEngine {
+	if cfg.tplengine == nil {
+		switch cfg.TemplateEngine {
+		case "liquid":
+			cfg.tplengine = newLiquidEngine(cfg)
+		default:
+			cfg.tplengine = &pongoEngine{cfg: cfg}
+		}
+	}
+	return cfg.tplengine
+}
+
+type pongoEngine struct {
+	cfg *config
+}
+
+func (e *pongoEngine) renderString(src, content string, vars pongo2.Context) (string, error) {
+	tpl, err := e.cfg.templateSet().FromString(content)
+	if err != nil {
+		return "", err
+	}
+	return e.execute(tpl, vars)
+}
+
+func (e *pongoEngine) renderFile(path string, vars pongo2.Context) (string, error) {
+	tpl, err := e.cfg.templateSet().FromCache(path)
+	if err != nil {
+		return "", err
+	}
+	return e.execute(tpl, vars)
+}
+
+// execute renders the template with vars, which the filters such as
+// where_exp see as the variables of the template.
+func (e *pongoEngine) execute(tpl *pongo2.Template, vars pongo2.Context) (string, error) {
+	vars = e.safeContent(vars)
+	e.cfg.pushVars(vars)
+	defer e.cfg.popVars()
+	return tpl.Execute(vars)
+}
+
+// pushVars records the variables of the template being rendered, until
+// popVars.
+func (cfg *config) pushVars(vars pongo2.Context) {
+	cfg.renderVars = append(cfg.renderVars, vars)
+}
+
+func (cfg *config) popVars() {
+	cfg.renderVars = cfg.renderVars[:len(cfg.renderVars)-1]
+}
+
+func (e *pongoEngine) renderLayout(path string, blocks, vars pongo2.Context) (string, error) {
+	if err := e.cfg.checkExtends(path); err != nil {
+		return "", err
+	}
+	if len(blocks) == 0 {
+		return e.renderFile(path, vars)
+	}
+	newvars := pongo2.Context{}
+	newvars.Update(vars)
+	newvars.Update(blockVars(blocks))
+	return e.renderString(path, layoutWithBlocks(path, blocks), newvars)
+}
+
+// safeContent marks content, which is HTML rendered by jedie, as safe so
+// that autoescaping does not escape it.
+func (e *pongoEngine) safeContent(vars pongo2.Context) pongo2.Context {
+	content, ok := vars["content"].(string)
+	if !e.cfg.Autoescape || !ok {
+		return vars
+	}
+	newvars := pongo2.Context{}
+	newvars.Update(vars)
+	newvars["content"] = pongo2.AsSafeValue(content)
+	return newvars
+}
+
+// markSafe records the HTML s rendered by jedie, such as page.content and
+// post.content, so that autoescaping does not escape it.
+func (cfg *config) markSafe(s string) {
+	if !cfg.Autoescape || s == "" {
+		return
+	}
+	if cfg.safeHTML == nil {
+		cfg.safeHTML = map[string]bool{}
+	}
+	cfg.safeHTML[s] = true
+}
+
+func (e *pongoEngine) cleanCache() {
+	// Cached templates have their includes and parent templates compiled
+	// in, so drop all of them.
+	e.cfg.templateSet().CleanCache()
+}
@@ -0,0 +1,264 @@
+package site
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flosch/pongo2"
+)
+
+func makeSite(content string, files map[string]string) (string, *config) {
+	dir := makeConfig(content)
+	for name, content := range files {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			panic(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			panic(err)
+		}
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(dir); err != nil {
+		panic(err)
+	}
+	cfg := &config{}
+	if err := cfg.load("_config.yml"); err != nil {
+		panic(err)
+	}
+	pongoSetup(cfg)
+	return dir, cfg
+}
+
+func TestTemplateSetInclude(t *testing.T) {
+	dir, cfg := makeSite("name: jedie", map[string]string{
+		"_includes/hello.html":  "Hello {{ name }}",
+		"_layouts/default.html": "---\ntitle: ignored\n---\n[{% include \"hello.html\" %}]",
+		"secret.txt":            "secret",
+	})
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{`{% include "hello.html" %}`, "Hello jedie"},
+		{`{% include "default.html" %}`, "[Hello jedie]"},
+		{`{% include "../secret.txt" %}`, "secret"},
+	}
+	for _, test := range tests {
+		tpl, err := cfg.templateSet().FromString(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := tpl.Execute(pongo2.Context{"name": "jedie"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != test.out {
+			t.Errorf("expected %q actual %q", test.out, actual)
+		}
+	}
+
+	for _, in := range []string{
+		`{% include "../../../../../../../../etc/passwd" %}`,
+		`{% include "` + filepath.ToSlash(filepath.Dir(dir)) + `/other/secret.txt" %}`,
+		`{% ssi "../secret.txt" %}`,
+	} {
+		// Includes are resolved when executed, ssi when parsed.
+		tpl, err := cfg.templateSet().FromString(in)
+		if err == nil {
+			_, err = tpl.Execute(pongo2.Context{})
+		}
+		if err == nil {
+			t.Errorf("expected %s to be refused", in)
+		}
+	}
+}
+
+func TestTemplateSetCache(t *testing.T) {
+	dir, cfg := makeSite("name: jedie", map[string]string{
+		"_layouts/default.html": "old",
+	})
+	defer os.RemoveAll(dir)
+
+	layout := filepath.ToSlash(filepath.Join(dir, "_layouts", "default.html"))
+	tpl1, err := cfg.templateSet().FromCache(layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(layout, []byte("new"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl2, err := cfg.templateSet().FromCache(layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tpl1 != tpl2 {
+		t.Fatal("Template should be cached")
+	}
+
+	cfg.templateSet().CleanCache()
+	tpl3, err := cfg.templateSet().FromCache(layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := tpl3.Execute(pongo2.Context{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(actual, "new") {
+		t.Fatalf("Template should be reloaded: %q", actual)
+	}
+}
+
+func TestLiquidEngine(t *testing.T) {
+	dir, cfg := makeSite(`
+name: Liquid Site
+template_engine: liquid
+	`, map[string]string{
+		"_includes/figure.html": `<figure><img src="{{ include.src }}"><figcaption>{{ include.caption | upcase }}</figcaption></figure>`,
+		"_layouts/default.html": "---\n---\n<title>{{ site.name }}</title>{{ content }}",
+		"_layouts/post.html":    "---\nlayout: default\n---\n<h1>{{ page.title | upcase }}</h1>{{ content }}",
+		"_posts/2013-11-23-hello.md": `---
+layout: post
+title: Hello
+tags: [go, liquid]
+---
+{% assign n = page.title | size %}{% capture greeting %}hi {{ n }}{% endcapture %}{{ greeting }}
+{% if tags contains "go" %}gopher{% endif %}
+{% include figure.html src="a.png" caption=page.title %}
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	from := filepath.ToSlash(filepath.Join(dir, "_posts", "2013-11-23-hello.md"))
+	to := filepath.Join(dir, "_site", "hello.html")
+	cfg.vars["site"] = pongo2.Context{"name": cfg.Name}
+	if err := cfg.convertFile(context.Background(), from, to); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"<title>Liquid Site</title>",
+		"<h1>HELLO</h1>",
+		"hi 5",
+		"gopher",
+		`<img src="a.png"><figcaption>HELLO</figcaption>`,
+	} {
+		if !strings.Contains(string(b), s) {
+			t.Errorf("%q is not in %q", s, string(b))
+		}
+	}
+}
+
+func TestLinkTags(t *testing.T) {
+	for _, engine := range []string{"pongo2", "liquid"} {
+		dir, cfg := makeSite("name: jedie\npermalink: /:year/:month/:title/\ntemplate_engine: "+engine, map[string]string{
+			"_posts/2013-11-23-welcome-to-jedie.md": "---\ntitle: Welcome\n---\nwelcome",
+			"about.md":                              "---\ntitle: About\n---\n[{% post_url 2013-11-23-welcome-to-jedie %}]({% link _posts/2013-11-23-welcome-to-jedie.md %}) {% link about.md %}",
+		})
+		defer os.RemoveAll(dir)
+
+		if err := cfg.build(context.Background()); err != nil {
+			t.Fatalf("%s: %v", engine, err)
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, "_site", "about.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `<a href="/2013/11/welcome-to-jedie/">/2013/11/welcome-to-jedie/</a> /about.html`
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("%s: want %q in %q", engine, want, string(b))
+		}
+
+		tests := []struct {
+			tag string
+			err string
+		}{
+			{`{% post_url 2013-11-24-missing %}`, `post_url: no post named "2013-11-24-missing"`},
+			{`{% link missing.md %}`, `link: no page or post at "missing.md"`},
+		}
+		for _, test := range tests {
+			if err := ioutil.WriteFile(filepath.Join(dir, "about.md"), []byte(test.tag), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := cfg.build(context.Background())
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("%s: %s: want error %q but got %v", engine, test.tag, test.err, err)
+			}
+		}
+	}
+}
+
+func TestIncludeParams(t *testing.T) {
+	for _, engine := range []string{"pongo2", "liquid"} {
+		dir, cfg := makeSite("name: jedie\ntemplate_engine: "+engine, map[string]string{
+			"_includes/figure.html": `<figure>{{ include.src }}|{{ include.caption }}|{% include note.html text=include.caption %}</figure>`,
+			"_includes/note.html":   `<em>{{ include.text }}</em>`,
+			"_includes/loop.html":   `{% include loop.html %}`,
+			"notes/part.html":       "---\n---\npart of {{ page.title }}",
+			"notes/index.html":      "---\ntitle: Notes\n---\n{% include figure.html src=\"a.png\" caption=page.title %} {% include_relative part.html %}",
+			"notes/loop.html":       "{% include loop.html %}",
+			"notes/escape.html":     "{% include_relative ../../secret.html %}",
+			"notes/var.html":        "---\nsidebar: note.html\n---\n{% include {{ page.sidebar }} text=\"a\" %}",
+			"notes/expr.html":       "---\nsidebar: note.html\n---\n{% include page.sidebar text=\"b\" %}",
+		})
+		defer os.RemoveAll(dir)
+		cfg.vars["site"] = pongo2.Context{"name": cfg.Name}
+
+		tests := []struct {
+			name string
+			want string
+			err  string
+		}{
+			{"index.html", `<figure>a.png|Notes|<em>Notes</em></figure> part of Notes`, ""},
+			{"loop.html", "", "includes nested more than 16 levels"},
+			{"escape.html", "", "outside of the source directory"},
+		}
+		// pongo2 takes an expression for the name as its own include, and
+		// Liquid takes {{ }} as Jekyll.
+		test := struct {
+			name string
+			want string
+			err  string
+		}{"expr.html", "<em>b</em>", ""}
+		if engine == "liquid" {
+			test.name, test.want = "var.html", "<em>a</em>"
+		}
+		tests = append(tests, test)
+		for _, test := range tests {
+			from := filepath.ToSlash(filepath.Join(dir, "notes", test.name))
+			to := filepath.Join(dir, "_site", "notes", test.name)
+			err := cfg.convertFile(context.Background(), from, to)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("%s: %s: want error %q but got %v", engine, test.name, test.err, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%s: %s: %v", engine, test.name, err)
+			}
+			b, err := ioutil.ReadFile(to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(string(b)); got != test.want {
+				t.Fatalf("%s: %s: want %q but got %q", engine, test.name, test.want, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package site
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v1"
+)
+
+// themeUnsafe are the keys of the config which a theme may not set, so that
+// installing a theme runs no commands and writes nothing outside of the
+// destination of the site.
+var themeUnsafe = []string{"conversion", "generators", "hooks", "source", "destination", "cache_dir", "theme"}
+
+// loadTheme finds the directory of the theme, which is a path or a name of
+// a directory in _themes of the source directory, and returns the site
+// config b over _config.yml of the theme, without the keys of themeUnsafe.
+// The layouts and includes of the theme are looked up after the ones of the
+// site, and the paths in the config of the theme are relative to the theme
+// directory.
+func (cfg *config) loadTheme(b []byte) ([]byte, error) {
+	source := cfg.Source
+	if source == "" {
+		source = "."
+	}
+	dir := cfg.Theme
+	if !filepath.IsAbs(dir) {
+		if fi, err := cfg.stat(cfg.abs(filepath.Join(source, "_themes", dir))); err == nil && fi.IsDir() {
+			dir = filepath.Join(source, "_themes", dir)
+		}
+	}
+	dir = cfg.abs(dir)
+	if fi, err := cfg.stat(dir); err != nil || !fi.IsDir() {
+		return nil, fmt.Errorf("theme: %s: not found", cfg.Theme)
+	}
+	cfg.themeDir = filepath.ToSlash(dir)
+	cfg.themeLayouts = cfg.themePath("_layouts")
+	cfg.themeIncludes = cfg.themePath("_includes")
+
+	tb, err := cfg.readFile(path.Join(dir, "_config.yml"))
+	if os.IsNotExist(err) {
+		return b, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var theme, site map[interface{}]interface{}
+	if err := yaml.Unmarshal(tb, &theme); err != nil {
+		return nil, fmt.Errorf("theme: %v", err)
+	}
+	if err := yaml.Unmarshal(b, &site); err != nil {
+		return nil, err
+	}
+	for _, key := range themeUnsafe {
+		delete(theme, key)
+	}
+	themeRel := func(v interface{}) interface{} {
+		p, ok := v.(string)
+		if !ok || p == "" || path.IsAbs(filepath.ToSlash(p)) {
+			return v
+		}
+		return path.Join(cfg.themeDir, p)
+	}
+	if p, ok := themeRel(theme["layouts"]).(string); ok && p != "" {
+		cfg.themeLayouts = p
+	}
+	if p, ok := themeRel(theme["includes"]).(string); ok && p != "" {
+		cfg.themeIncludes = p
+	}
+	delete(theme, "layouts")
+	delete(theme, "includes")
+	if s, ok := theme["sass"].(map[interface{}]interface{}); ok {
+		s["sass_dir"] = themeRel(s["sass_dir"])
+		if paths, ok := s["load_paths"].([]interface{}); ok {
+			for i, p := range paths {
+				paths[i] = themeRel(p)
+			}
+		}
+	}
+	b, err = yaml.Marshal(mergeSettings(theme, site))
+	if err != nil {
+		return nil, fmt.Errorf("theme: %v", err)
+	}
+	return b, nil
+}
+
+// mergeSettings returns the settings of over merged over the ones of base.
+// The sections of both are merged by their keys.
+func mergeSettings(base, over map[interface{}]interface{}) map[interface{}]interface{} {
+	merged := map[interface{}]interface{}{}
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range over {
+		bm, ok1 := merged[k].(map[interface{}]interface{})
+		om, ok2 := v.(map[interface{}]interface{})
+		if ok1 && ok2 {
+			v = mergeSettings(bm, om)
+		}
+		merged[k] = v
+	}
+	return merged
+}
+
+// themePath returns the path of name in the theme directory, or an empty
+// string if the site has no theme.
+func (cfg *config) themePath(name string) string {
+	if cfg.themeDir == "" {
+		return ""
+	}
+	return filepath.ToSlash(filepath.Join(cfg.themeDir, name))
+}
+
+// sourceDirs returns the directories of the pages, the assets directory of
+// the theme last so that files of the site override them. The other files
+// of the theme, such as its README, are not a part of the site.
+func (cfg *config) sourceDirs() []string {
+	dirs := []string{cfg.Source}
+	if assets := cfg.themePath("assets"); assets != "" {
+		if fi, err := cfg.stat(assets); err == nil && fi.IsDir() {
+			dirs = append(dirs, assets)
+		}
+	}
+	return dirs
+}
+
+// sourceRel returns the path of the page relative to the source directory
+// or the theme directory. The theme is tried first as it may be in the
+// source directory.
+func (cfg *config) sourceRel(from string) string {
+	for _, dir := range []string{cfg.themeDir, cfg.Source} {
+		if dir == "" {
+			continue
+		}
+		if strings.HasPrefix(from, dir+"/") {
+			return from[len(dir)+1:]
+		}
+	}
+	return ""
+}
+
+// templateDirs returns the directories where includes and layouts are
+// looked up, the ones of the theme last.
+func (cfg *config) templateDirs() []string {
+	dirs := []string{cfg.Includes, cfg.Layouts}
+	if cfg.themeDir != "" {
+		dirs = append(dirs, cfg.themeIncludes, cfg.themeLayouts)
+	}
+	return dirs
+}
+
+// lookup returns the path of name in dir, or in themeDir of the theme if it
+// is not in dir.
+func (cfg *config) lookup(dir, themeDir, name string) string {
+	p := filepath.ToSlash(filepath.Join(dir, name))
+	if _, err := cfg.stat(p); err != nil && themeDir != "" {
+		tp := filepath.ToSlash(filepath.Join(themeDir, name))
+		if _, err := cfg.stat(tp); err == nil {
+			return tp
+		}
+	}
+	return p
+}
+
+// lookupSource returns the path of the file name in the source directory,
+// or in the assets directory of the theme.
+func (cfg *config) lookupSource(name string) string {
+	themeDir := ""
+	if strings.HasPrefix(path.Clean(filepath.ToSlash(name)), "assets/") {
+		themeDir = cfg.themeDir
+	}
+	return cfg.lookup(cfg.Source, themeDir, name)
+}
+
+// dataDirs returns the data directories, the theme first so that data of
+// the site override them.
+func (cfg *config) dataDirs() []string {
+	if cfg.themeDir == "" {
+		return []string{cfg.Data}
+	}
+	return []string{cfg.themePath("_data"), cfg.Data}
+}
@@ -0,0 +1,98 @@
+package site
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTheme(t *testing.T) {
+	dir, cfg := makeSite("name: team\ntheme: corp", map[string]string{
+		"_themes/corp/_config.yml":             "title: Corp\nlayouts: _templates\npermalink: /blog/:title/\ndestination: ../out\ngenerators:\n  - command: [touch, pwned]\n",
+		"_themes/corp/_templates/default.html": "THEME {{ content }}",
+		"_themes/corp/_templates/post.html":    "---\nlayout: default\n---\n<article>{{ content }}</article>",
+		"_themes/corp/_includes/nav.html":      "<nav>{{ site.data.links.home }} {{ site.data.menu.top }}</nav>",
+		"_themes/corp/_includes/footer.html":   "<footer>corp</footer>",
+		"_themes/corp/_data/links.yml":         "home: /corp/",
+		"_themes/corp/_data/menu.yml":          "top: corp",
+		"_themes/corp/assets/css/site.css":     "body {}",
+		"_themes/corp/assets/robots.txt":       "theme",
+		"_themes/corp/README.md":               "# Corp theme",
+		"_themes/corp/LICENSE":                 "MIT",
+		"_layouts/default.html":                "<title>{{ site.title }} by {{ site.name }}</title>{% include \"nav.html\" %}{{ content }}{% include \"footer.html\" %}",
+		"_includes/footer.html":                "<footer>team</footer>",
+		"_data/menu.yml":                       "top: team",
+		"assets/robots.txt":                    "site",
+		"_posts/2013-11-23-hello.md":           "---\nlayout: post\ntitle: Hello\n---\nhello",
+	})
+	defer os.RemoveAll(dir)
+
+	if err := cfg.build(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"blog/hello/index.html", "<title>Corp by team</title><nav>/corp/ team</nav><article><p>hello</p>\n</article><footer>team</footer>"},
+		{"assets/css/site.css", "body {}"},
+		{"assets/robots.txt", "site"},
+	}
+	for _, test := range tests {
+		b, err := ioutil.ReadFile(filepath.Join(dir, "_site", test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSpace(string(b)); got != test.want {
+			t.Errorf("%s: want %q but got %q", test.file, test.want, got)
+		}
+	}
+
+	// The commands and the directories of the site are not taken from the
+	// config of the theme, and only the assets of the theme are published.
+	for _, name := range []string{"pwned", "out", "_themes/out", "_site/README.html", "_site/LICENSE", "_site/_config.yml"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("want no %s but got %v", name, err)
+		}
+	}
+
+	cfg = &config{Theme: "missing"}
+	if _, err := cfg.loadTheme(nil); err == nil || !strings.Contains(err.Error(), "theme: missing: not found") {
+		t.Errorf("want not found error but got %v", err)
+	}
+}
+
+func TestNewWithTheme(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jedie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	theme := filepath.Join(dir, "corp")
+	site := filepath.Join(dir, "site")
+	for _, d := range []string{theme, site} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := CreateWithTheme(site, theme); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(site, "_config.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "theme: ../corp\n") {
+		t.Errorf("want theme in %q", string(b))
+	}
+	if _, err := os.Stat(filepath.Join(site, "_layouts")); err == nil {
+		t.Errorf("want no _layouts in the site of a theme")
+	}
+	if err := CreateWithTheme(site, filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("want error for missing theme")
+	}
+}